@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// tailBlockSize is the size of the blocks read
+// when looking for the last lines of a file.
+const tailBlockSize = 64 * 1024
+
+// followInterval is how often a followed file is checked
+// for new data once all of it was read.
+var followInterval = 250 * time.Millisecond
+
+// follower reads a file that keeps growing, like tail -F.
+//
+// Instead of returning io.EOF at the end of the file it waits for more
+// data, until the context is cancelled. If the file is truncated it is
+// read again from the beginning, and if it is rotated (the name now
+// refers to a different file) what is left of the old file is read and
+// then the new file is read from the beginning.
+type follower struct {
+	ctx    context.Context
+	name   string
+	file   *os.File
+	offset int64
+	// next is the file that replaced the followed
+	// file, read once the old one is done.
+	next *os.File
+}
+
+// newFollower opens the named file to be followed, starting on the
+// beginning of the last n lines of the file (at the end if n is 0).
+func newFollower(ctx context.Context, name string, n int) (*follower, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := tailOffset(f, n)
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &follower{
+		ctx:    ctx,
+		name:   name,
+		file:   f,
+		offset: offset,
+	}, nil
+}
+
+// Read reads data from the followed file, blocking until there
+// is data available. It only fails if the context is cancelled
+// or the file can't be read.
+func (f *follower) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for {
+		n, err := f.file.Read(p)
+		f.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if f.next != nil {
+			f.file.Close()
+			f.file = f.next
+			f.next = nil
+			f.offset = 0
+			continue
+		}
+
+		rotated, err := f.checkFile()
+		if err != nil {
+			return 0, err
+		}
+		if rotated {
+			// The old file is read once more, since data may have
+			// been written to it after the last read.
+			continue
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return 0, f.ctx.Err()
+		case <-time.After(followInterval):
+		}
+	}
+}
+
+// checkFile checks if the followed file was truncated, in which case
+// it is read again from the beginning, or rotated, in which case the
+// new file is opened and it returns true. A missing file is not an
+// error since it may be recreated, like while being rotated.
+func (f *follower) checkFile() (bool, error) {
+	info, err := os.Stat(f.name)
+	if err != nil {
+		return false, nil
+	}
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if !os.SameFile(info, current) {
+		next, err := os.Open(f.name)
+		if err != nil {
+			return false, nil
+		}
+		f.next = next
+		return true, nil
+	}
+
+	if current.Size() < f.offset {
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.offset = 0
+	}
+	return false, nil
+}
+
+// Close closes the followed file.
+func (f *follower) Close() error {
+	if f.next != nil {
+		f.next.Close()
+	}
+	return f.file.Close()
+}
+
+// tailOffset returns the offset where the last n lines of the file
+// start. A newline at the end of the file doesn't start a new line.
+// If the file has less than n lines it returns 0.
+func tailOffset(f *os.File, n int) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := info.Size()
+	if n <= 0 || end == 0 {
+		return end, nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, end-1); err != nil {
+		return 0, err
+	}
+	if last[0] == '\n' {
+		end--
+	}
+
+	block := make([]byte, tailBlockSize)
+	for pos := end; pos > 0; {
+		size := int64(len(block))
+		if pos < size {
+			size = pos
+		}
+		pos -= size
+
+		data := block[:size]
+		if _, err := f.ReadAt(data, pos); err != nil {
+			return 0, err
+		}
+		for i := len(data) - 1; i >= 0; i-- {
+			if data[i] != '\n' {
+				continue
+			}
+			n--
+			if n == 0 {
+				return pos + int64(i) + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
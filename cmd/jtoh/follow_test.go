@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTailOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		n    int
+		want int64
+	}{
+		{name: "Zero", data: "a\nb\n", n: 0, want: 4},
+		{name: "Empty", data: "", n: 2, want: 0},
+		{name: "LastLine", data: "a\nb\nc\n", n: 1, want: 4},
+		{name: "LastLines", data: "a\nb\nc\n", n: 2, want: 2},
+		{name: "AllLines", data: "a\nb\nc\n", n: 3, want: 0},
+		{name: "MoreThanAllLines", data: "a\nb\nc\n", n: 10, want: 0},
+		{name: "NoNewlineAtEnd", data: "a\nb\nc", n: 1, want: 4},
+		{name: "BlankLines", data: "a\n\n\n", n: 2, want: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := createFile(t, filepath.Join(t.TempDir(), "log"), test.data)
+			defer f.Close()
+
+			got, err := tailOffset(f, test.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("tailOffset(%q, %d): got %d want %d", test.data, test.n, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFollower(t *testing.T) {
+	defer setFollowInterval(time.Millisecond)()
+
+	name := filepath.Join(t.TempDir(), "app.log")
+	createFile(t, name, "old1\nold2\n").Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f, err := newFollower(ctx, name, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	readData := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			readData <- string(buf[:n])
+		}
+	}()
+
+	want := func(data string) {
+		t.Helper()
+		got := ""
+		for got != data {
+			select {
+			case read := <-readData:
+				got += read
+			case err := <-readErr:
+				t.Fatalf("unexpected error [%v] reading %q", err, got)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("got %q want %q", got, data)
+			}
+		}
+	}
+
+	want("old2\n")
+
+	appendFile(t, name, "grown\n")
+	want("grown\n")
+
+	// Truncation
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	appendFile(t, name, "new\n")
+	want("new\n")
+
+	// Rotation, files that are open can't be renamed on Windows
+	if runtime.GOOS != "windows" {
+		appendFile(t, name, "before rotation\n")
+		want("before rotation\n")
+		if err := os.Rename(name, name+".1"); err != nil {
+			t.Fatal(err)
+		}
+		appendFile(t, name+".1", "after rotation\n")
+		createFile(t, name, "rotated\n").Close()
+		want("after rotation\nrotated\n")
+	}
+
+	cancel()
+	select {
+	case err := <-readErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got err [%v] want [%v]", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("read not cancelled")
+	}
+}
+
+func createFile(t *testing.T, name, data string) *os.File {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func appendFile(t *testing.T, name, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setFollowInterval(interval time.Duration) func() {
+	old := followInterval
+	followInterval = interval
+	return func() { followInterval = old }
+}
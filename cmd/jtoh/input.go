@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// stdinName is the name used to read from stdin.
+const stdinName = "-"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// bzip2 data starts with "BZh", the block size ('1' to '9') and
+	// then the magic of the first block, or of the end of the stream
+	// if there are no blocks.
+	bzip2Magic       = []byte("BZh")
+	bzip2BlockMagic  = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2StreamMagic = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// bzip2HeaderSize is the size of the header checked to detect bzip2 data.
+const bzip2HeaderSize = 10
+
+// expandInputs expands the glob patterns on the given names, keeping
+// the order of the names. Names that are not patterns, or patterns
+// that match no file, are kept as they are so opening them reports
+// the error. With no names the input is stdin.
+func expandInputs(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{stdinName}, nil
+	}
+
+	var inputs []string
+	for _, name := range names {
+		matches, err := filepath.Glob(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %q: %v", name, err)
+		}
+		if len(matches) == 0 {
+			inputs = append(inputs, name)
+			continue
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, nil
+}
+
+// openInput opens the named input ("-" for stdin), which is
+// decompressed if needed. The returned closer must be called
+// when done reading.
+func openInput(name string) (io.Reader, io.Closer, error) {
+	if name == stdinName {
+		r, closer, err := decompress(os.Stdin)
+		return r, closer, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, closer, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return r, closers{closer, f}, nil
+}
+
+// decompress detects if the data is compressed with gzip, bzip2 or
+// zstd by its magic bytes and returns a reader that decompresses it.
+// Data that is not compressed is returned as it is.
+func decompress(r io.Reader) (io.Reader, io.Closer, error) {
+	br := bufio.NewReader(r)
+	magic := peekHeader(br)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading gzip data: %v", err)
+		}
+		return gr, gr, nil
+	case isBzip2(magic):
+		return bzip2.NewReader(br), closers{}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading zstd data: %v", err)
+		}
+		return zr, zstdCloser{zr}, nil
+	}
+	return br, closers{}, nil
+}
+
+// peekHeader returns the first bytes of the data, without consuming
+// them. More data is only read while the bytes may still be the header
+// of compressed data, so a stream of plain data is not held waiting
+// for more data than it has (like a single short line).
+func peekHeader(br *bufio.Reader) []byte {
+	header, _ := br.Peek(1)
+	for len(header) > 0 && mayBeHeader(header) {
+		more, err := br.Peek(len(header) + 1)
+		if err != nil {
+			return more
+		}
+		header = more
+	}
+	return header
+}
+
+// mayBeHeader returns true if the data may be the beginning
+// of the header of compressed data, so more data is needed.
+func mayBeHeader(data []byte) bool {
+	if len(data) >= bzip2HeaderSize {
+		return false
+	}
+	return bytes.HasPrefix(gzipMagic, data) ||
+		bytes.HasPrefix(zstdMagic, data) ||
+		bytes.HasPrefix(bzip2Magic, data) ||
+		bytes.HasPrefix(data, bzip2Magic)
+}
+
+// isBzip2 returns true if the header is the header of bzip2 data,
+// checking more than "BZh" since text may start with it.
+func isBzip2(header []byte) bool {
+	if len(header) < bzip2HeaderSize || !bytes.HasPrefix(header, bzip2Magic) {
+		return false
+	}
+	if header[3] < '1' || header[3] > '9' {
+		return false
+	}
+	block := header[4:bzip2HeaderSize]
+	return bytes.Equal(block, bzip2BlockMagic) || bytes.Equal(block, bzip2StreamMagic)
+}
+
+// closers closes all the closers, returning the first error.
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var first error
+	for _, closer := range c {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type zstdCloser struct {
+	d *zstd.Decoder
+}
+
+func (z zstdCloser) Close() error {
+	z.d.Close()
+	return nil
+}
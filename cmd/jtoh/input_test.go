@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.json", "a.json", "c.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := expandInputs([]string{
+		filepath.Join(dir, "c.log"),
+		filepath.Join(dir, "*.json"),
+		"-",
+		filepath.Join(dir, "missing.json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		filepath.Join(dir, "c.log"),
+		filepath.Join(dir, "a.json"),
+		filepath.Join(dir, "b.json"),
+		"-",
+		filepath.Join(dir, "missing.json"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	got, err = expandInputs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-"}; !slices.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	if _, err := expandInputs([]string{"[invalid"}); err == nil {
+		t.Error("want error on invalid pattern")
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	const data = "hello\n"
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte(data))
+	gw.Close()
+
+	var zstded bytes.Buffer
+	zw, err := zstd.NewWriter(&zstded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write([]byte(data))
+	zw.Close()
+
+	// The standard library has no bzip2 writer, this is "hello\n"
+	// compressed with the bzip2 tool.
+	bzipped := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xc1, 0xc0, 0x80, 0xe2, 0x00, 0x00,
+		0x01, 0x41, 0x00, 0x00, 0x10, 0x02, 0x44, 0xa0, 0x00, 0x30, 0xcd, 0x00, 0xc3, 0x46, 0x29, 0x97,
+		0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0xc1, 0xc0, 0x80, 0xe2,
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "Plain", input: []byte(data)},
+		{name: "Gzip", input: gzipped.Bytes()},
+		{name: "Bzip2", input: bzipped},
+		{name: "Zstd", input: zstded.Bytes()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, input := range []io.Reader{
+				bytes.NewReader(test.input),
+				iotest.OneByteReader(bytes.NewReader(test.input)),
+			} {
+				r, closer, err := decompress(input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer closer.Close()
+
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != data {
+					t.Errorf("got %q want %q", got, data)
+				}
+			}
+		})
+	}
+}
+
+func TestDecompressShortInput(t *testing.T) {
+	r, closer, err := decompress(bytes.NewReader([]byte("{")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "{" {
+		t.Errorf("got %q want %q", got, "{")
+	}
+}
+
+func TestDecompressTextThatLooksLikeBzip2(t *testing.T) {
+	for _, data := range []string{"BZh is not bzip\n", "BZh91AY&SX\n", "BZh", "BZh0" + "1AY&SY\n"} {
+		r, closer, err := decompress(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		defer closer.Close()
+
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		if string(got) != data {
+			t.Errorf("got %q want %q", got, data)
+		}
+	}
+}
+
+func TestDecompressDoesNotWaitForMoreData(t *testing.T) {
+	const line = "{\"a\":1}\n"
+	input := &stallReader{data: line, t: t}
+
+	r, closer, err := decompress(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	got := make([]byte, len(line))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != line {
+		t.Errorf("got %q want %q", got, line)
+	}
+}
+
+// stallReader returns its data on the first read and fails the
+// test on any other read, like a stream that has no more data yet.
+type stallReader struct {
+	data string
+	read bool
+	t    *testing.T
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if r.read {
+		r.t.Error("read more data than available")
+		return 0, io.EOF
+	}
+	r.read = true
+	return copy(p, r.data), nil
+}
+
+func TestDecompressEmptyBzip2(t *testing.T) {
+	// An empty file compressed with the bzip2 tool.
+	bzipped := []byte{0x42, 0x5a, 0x68, 0x39, 0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0x00, 0x00, 0x00, 0x00}
+
+	r, closer, err := decompress(bytes.NewReader(bzipped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %q want empty data", got)
+	}
+}
+
+func TestOpenInputMissingFile(t *testing.T) {
+	if _, _, err := openInput(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("want error opening missing file")
+	}
+}
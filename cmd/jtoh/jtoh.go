@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/madlambda/jtoh"
 )
@@ -11,17 +18,287 @@ import (
 var Version = ""
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("usage: %s <selector>\n", os.Args[0])
-		fmt.Printf("example: %s :field1:nested.field2\n", os.Args[0])
-		fmt.Printf("jtoh version: %q\n", Version)
+	tmpl := flag.String("t", "", "render each JSON object with a Go text/template instead of a selector")
+	where := flag.String("w", "", "only transform JSON objects that match the filter expression")
+	flatten := flag.Bool("flatten", false, "render selected objects and arrays as key=value pairs instead of JSON (with -o json use the selectors as keys)")
+	output := flag.String("o", "text", "output format: text, csv, tsv, table, json or logfmt")
+	color := flag.String("color", "auto", "color the output: auto (if stdout is a terminal and NO_COLOR is not set), always or never")
+	severity := flag.String("severity", "severity|level", "selector of the severity field used to color lines")
+	logfmt := flag.String("logfmt", "auto", "handling of logfmt lines: auto, force or off")
+	containerLogs := flag.Bool("container-logs", false, "handle the CRI, Docker json-file and kubectl --timestamps log formats, setting the _ts and _stream fields")
+	embeddedJSON := flag.Bool("embedded-json", false, "transform JSON objects embedded on text lines, with the text before them as the _prefix field")
+	trailers := flag.Bool("trailers", false, "group the lines that continue a record, like stack traces, as the _trailer field written under the record")
+	header := flag.Bool("header", false, "write a header with the field selectors (csv and tsv only)")
+	follow := flag.Bool("f", false, "follow the input file as it grows, surviving rotation and truncation, like tail -F")
+	lines := flag.Int("n", 0, "with -f, start from the last n lines (not records) of the file instead of the end")
+	prefixFilename := flag.Bool("prefix-filename", false, "add the name of the input file as the first field (_file)")
+	flag.Usage = usage
+	// Errors exit, since the flag set uses flag.ExitOnError.
+	_ = flag.CommandLine.Parse(selectorArgs(flag.CommandLine, os.Args[1:]))
+
+	var (
+		err  error
+		opts []jtoh.Option
+	)
+
+	if *where != "" {
+		filter, err := jtoh.ParseFilter(*where)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts = append(opts, jtoh.WithFilter(filter))
+	}
+
+	if *flatten {
+		opts = append(opts, jtoh.WithFlatten())
+	}
+
+	format, err := jtoh.ParseFormat(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	opts = append(opts, jtoh.WithOutput(format))
+
+	logfmtMode, err := jtoh.ParseLogfmtMode(*logfmt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	selector := os.Args[1]
-	j, err := jtoh.New(selector)
+	opts = append(opts, jtoh.WithLogfmt(logfmtMode))
+
+	useColor, err := colorEnabled(*color)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	j.Do(os.Stdin, os.Stdout)
+	if useColor {
+		severitySel, err := jtoh.Parse(*severity)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts = append(opts, jtoh.WithColor(), jtoh.WithSeverityField(severitySel))
+	}
+
+	if *containerLogs {
+		opts = append(opts, jtoh.WithContainerLogs())
+	}
+
+	if *embeddedJSON {
+		opts = append(opts, jtoh.WithEmbeddedJSON())
+	}
+
+	if *trailers {
+		opts = append(opts, jtoh.WithTrailers())
+	}
+
+	selector := ""
+	inputArgs := flag.Args()
+	if *tmpl == "" {
+		if flag.NArg() < 1 {
+			usage()
+			os.Exit(1)
+		}
+		selector = flag.Arg(0)
+		inputArgs = flag.Args()[1:]
+	}
+
+	if *prefixFilename {
+		if *tmpl != "" {
+			*tmpl = "{{._file}}: " + *tmpl
+		} else if selector != "" {
+			sep, _ := utf8.DecodeRuneInString(selector)
+			selector = string(sep) + "_file" + selector
+		}
+	}
+
+	newJ := func(opts ...jtoh.Option) (jtoh.J, error) {
+		if *tmpl != "" {
+			return jtoh.NewTemplate(*tmpl, opts...)
+		}
+		return jtoh.New(selector, opts...)
+	}
+
+	// The transformer is validated before any input is opened.
+	if _, err := newJ(opts...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	inputs, err := expandInputs(inputArgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *follow && (len(inputs) != 1 || inputs[0] == stdinName) {
+		fmt.Fprintln(os.Stderr, "jtoh: -f requires a single input file")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	inputJ := func(i int, name string) (jtoh.J, error) {
+		return newJ(inputOptions(opts, i, name, *header, *prefixFilename)...)
+	}
+
+	if *follow {
+		var j jtoh.J
+		j, err = inputJ(0, inputs[0])
+		if err == nil {
+			err = followInput(ctx, j, inputs[0], *lines)
+		}
+	} else {
+		err = transformInputs(ctx, inputs, inputJ, os.Stdout)
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "jtoh:error: %v\n", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// inputOptions returns the options used to transform the i-th input.
+// The output of the inputs is a single stream, so only the first
+// input has a header.
+func inputOptions(opts []jtoh.Option, i int, name string, header, prefixFilename bool) []jtoh.Option {
+	inputOpts := append([]jtoh.Option{}, opts...)
+	if header && i == 0 {
+		inputOpts = append(inputOpts, jtoh.WithHeader())
+	}
+	if i > 0 {
+		inputOpts = append(inputOpts, jtoh.WithoutHeader())
+	}
+	if prefixFilename {
+		inputOpts = append(inputOpts, jtoh.WithField("_file", displayName(name)))
+	}
+	return inputOpts
+}
+
+// selectorArgs returns the arguments with a "--" before the first
+// argument that looks like a flag but is a selector using "-" as the
+// separator (like -a-b), so it is not parsed as a flag. Only arguments
+// that are not flags and have more than one field are detected, other
+// selectors starting with "-" must come after a "--".
+func selectorArgs(flags *flag.FlagSet, args []string) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-" || !strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "--") {
+			return args
+		}
+		name, _, hasValue := strings.Cut(arg[1:], "=")
+		f := flags.Lookup(name)
+		if f == nil {
+			if !strings.Contains(name, "-") {
+				return args
+			}
+			selectorAt := append([]string{}, args[:i]...)
+			return append(append(selectorAt, "--"), args[i:]...)
+		}
+		if !hasValue && !isBoolFlag(f) {
+			// The next argument is the value of the flag
+			i++
+		}
+	}
+	return args
+}
+
+// isBoolFlag returns true if the flag doesn't need a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// displayName is the name of the input shown to the user.
+func displayName(name string) string {
+	if name == stdinName {
+		return "<stdin>"
+	}
+	return name
+}
+
+// transformInputs transforms the named inputs into w, one after
+// the other, using the transformer returned by newJ for each input.
+func transformInputs(
+	ctx context.Context,
+	inputs []string,
+	newJ func(i int, name string) (jtoh.J, error),
+	w io.Writer,
+) error {
+	for i, name := range inputs {
+		j, err := newJ(i, name)
+		if err != nil {
+			return err
+		}
+		if err := transformInput(ctx, j, name, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transformInput transforms the named input into w.
+func transformInput(ctx context.Context, j jtoh.J, name string, w io.Writer) error {
+	r, closer, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	return j.DoContext(ctx, r, w)
+}
+
+// followInput transforms the named input into stdout as it grows,
+// starting from its last n lines, until the context is cancelled.
+func followInput(ctx context.Context, j jtoh.J, name string, n int) error {
+	f, err := newFollower(ctx, name, n)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return j.DoContext(ctx, f, os.Stdout)
+}
+
+// colorEnabled checks if the output should be colored, by default
+// only terminals are colored, following https://no-color.org.
+func colorEnabled(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := os.Stdout.Stat()
+		if err != nil {
+			return false, nil
+		}
+		return info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid color mode:%s", mode)
+}
+
+func usage() {
+	fmt.Printf("usage: %s [flags] <selector> [files...]\n", os.Args[0])
+	fmt.Printf("usage: %s [flags] -t <template> [files...]\n", os.Args[0])
+	fmt.Printf("example: %s :field1:nested.field2\n", os.Args[0])
+	fmt.Printf("example: %s -t '{{.field1}} [{{.nested.field2}}]'\n", os.Args[0])
+	fmt.Printf("example: %s -w 'severity == \"ERROR\"' :field1\n", os.Args[0])
+	fmt.Printf("example: %s -o csv -header :field1:nested.field2\n", os.Args[0])
+	fmt.Printf("example: %s -f -n 10 :ts:msg app.log\n", os.Args[0])
+	fmt.Printf("example: %s -prefix-filename :ts:msg logs/*.json.gz other.ndjson\n", os.Args[0])
+	fmt.Printf("example: %s -- -field1\n", os.Args[0])
+	fmt.Printf("jtoh version: %q\n", Version)
+	fmt.Println("flags:")
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.PrintDefaults()
 }
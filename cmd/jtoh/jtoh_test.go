@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestTransformInputs(t *testing.T) {
+	type Test struct {
+		name           string
+		format         jtoh.Format
+		header         bool
+		prefixFilename bool
+		want           []string
+	}
+
+	tests := []Test{
+		{
+			name:   "Text",
+			format: jtoh.TextFormat,
+			want:   []string{"1", "2", "3"},
+		},
+		{
+			name:   "TableHeaderIsWrittenOnce",
+			format: jtoh.TableFormat,
+			want:   []string{"a", "1", "2", "3"},
+		},
+		{
+			name:   "CSVHeaderIsWrittenOnce",
+			format: jtoh.CSVFormat,
+			header: true,
+			want:   []string{"a", "1", "2", "3"},
+		},
+		{
+			name:           "PrefixFilename",
+			format:         jtoh.CSVFormat,
+			prefixFilename: true,
+			want:           []string{"1.json,1", "1.json,2", "2.json,3"},
+		},
+	}
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "1.json")
+	second := filepath.Join(dir, "2.json")
+	if err := os.WriteFile(first, []byte("{\"a\":1}\n{\"a\":2}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("{\"a\":3}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file names are relative, so the _file field is the same on any system.
+	chdir(t, dir)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selector := ":a"
+			if test.prefixFilename {
+				selector = ":_file:a"
+			}
+			opts := []jtoh.Option{jtoh.WithOutput(test.format)}
+			newJ := func(i int, name string) (jtoh.J, error) {
+				return jtoh.New(selector, inputOptions(opts, i, name, test.header, test.prefixFilename)...)
+			}
+
+			output := &bytes.Buffer{}
+			err := transformInputs(context.Background(), []string{"1.json", "2.json"}, newJ, output)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := strings.Join(test.want, "\n") + "\n"
+			if output.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+			}
+		})
+	}
+}
+
+func TestSelectorArgs(t *testing.T) {
+	type Test struct {
+		args []string
+		want []string
+	}
+
+	tests := []Test{
+		{args: []string{":a:b"}, want: []string{":a:b"}},
+		{args: []string{"-a-b"}, want: []string{"--", "-a-b"}},
+		{args: []string{"-a-b", "file"}, want: []string{"--", "-a-b", "file"}},
+		{args: []string{"-trailers", "-a-b"}, want: []string{"-trailers", "--", "-a-b"}},
+		{args: []string{"-trailers=true", "-a-b"}, want: []string{"-trailers=true", "--", "-a-b"}},
+		{args: []string{"-o", "csv", "-a-b"}, want: []string{"-o", "csv", "--", "-a-b"}},
+		{args: []string{"-o=csv", "-a-b"}, want: []string{"-o=csv", "--", "-a-b"}},
+		{args: []string{"-o", "-a-b"}, want: []string{"-o", "-a-b"}},
+		{args: []string{"-prefix-filename", ":a"}, want: []string{"-prefix-filename", ":a"}},
+		{args: []string{"-a"}, want: []string{"-a"}},
+		{args: []string{"--", "-a"}, want: []string{"--", "-a"}},
+		{args: []string{"-", "-a-b"}, want: []string{"-", "-a-b"}},
+	}
+
+	for _, test := range tests {
+		flags := flag.NewFlagSet("jtoh", flag.ContinueOnError)
+		flags.Bool("trailers", false, "")
+		flags.Bool("prefix-filename", false, "")
+		flags.String("o", "text", "")
+
+		got := selectorArgs(flags, test.args)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("selectorArgs(%q): got %q want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
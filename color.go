@@ -0,0 +1,129 @@
+package jtoh
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ANSI escape codes used to color the output.
+const (
+	colorReset = "\x1b[0m"
+	colorDim   = "\x1b[2m"
+	colorRed   = "\x1b[31m"
+	colorBold  = "\x1b[1;31m"
+	colorWarn  = "\x1b[33m"
+)
+
+// fieldColors are used for the selected fields, in order. Red and
+// yellow are left out since they are used for severities.
+var fieldColors = []string{
+	"\x1b[36m",
+	"\x1b[32m",
+	"\x1b[34m",
+	"\x1b[35m",
+}
+
+// defaultSeverity is the default selector of the severity field.
+var defaultSeverity = Selector{
+	raw:      "severity|level",
+	rawPaths: "severity|level",
+	paths: []path{
+		newPath([]step{{kind: keyStep, key: "severity"}}),
+		newPath([]step{{kind: keyStep, key: "level"}}),
+	},
+}
+
+// WithColor configures the transformer to color the output with ANSI
+// escape codes, for terminals. With TextFormat and TableFormat each
+// selected field has a different color, and lines of records with a
+// warning or error severity are colored entirely by the severity.
+// Data that is not JSON is dimmed. The other formats are not colored.
+//
+// The severity is selected with the selector of WithSeverityField.
+func WithColor() Option {
+	return func(j *J) {
+		j.color = true
+	}
+}
+
+// WithSeverityField configures the selector of the severity of the
+// records, used to color them. The default is "severity|level".
+func WithSeverityField(sel Selector) Option {
+	return func(j *J) {
+		j.severity = &sel
+	}
+}
+
+// severityColor returns the color of the record according to its
+// severity, or an empty string if the record is not colored by it.
+// Severities can be names, like "ERROR" or "warn", or numbers as
+// used by bunyan/pino (like 50 for errors).
+func (j J) severityColor(obj map[string]interface{}) string {
+	sel := defaultSeverity
+	if j.severity != nil {
+		sel = *j.severity
+	}
+	v, ok := sel.Select(obj)
+	if !ok {
+		return ""
+	}
+
+	if n, ok := v.(json.Number); ok {
+		level, err := n.Int64()
+		switch {
+		case err != nil:
+			return ""
+		case level >= 60:
+			return colorBold
+		case level >= 50:
+			return colorRed
+		case level >= 40:
+			return colorWarn
+		case level <= 20:
+			return colorDim
+		}
+		return ""
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return ""
+	}
+	s = strings.ToLower(s)
+	for _, prefix := range []string{"fatal", "panic", "crit", "alert", "emerg"} {
+		if strings.HasPrefix(s, prefix) {
+			return colorBold
+		}
+	}
+	switch {
+	case strings.HasPrefix(s, "err"):
+		return colorRed
+	case strings.HasPrefix(s, "warn"):
+		return colorWarn
+	case strings.HasPrefix(s, "debug"), strings.HasPrefix(s, "trace"):
+		return colorDim
+	}
+	return ""
+}
+
+// colorFields sets the colors of the fields, all fields have
+// the severity color when the record has one.
+func (j J) colorFields(obj map[string]interface{}, fields []field) {
+	lineColor := j.severityColor(obj)
+	for i := range fields {
+		if lineColor != "" {
+			fields[i].color = lineColor
+			continue
+		}
+		fields[i].color = fieldColors[i%len(fieldColors)]
+	}
+}
+
+// colorize wraps s with the given color. Empty
+// strings and colors are left untouched.
+func colorize(color, s string) string {
+	if color == "" || s == "" {
+		return s
+	}
+	return color + s + colorReset
+}
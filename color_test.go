@@ -0,0 +1,146 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+const (
+	reset   = "\x1b[0m"
+	dim     = "\x1b[2m"
+	red     = "\x1b[31m"
+	boldRed = "\x1b[1;31m"
+	yellow  = "\x1b[33m"
+	cyan    = "\x1b[36m"
+	green   = "\x1b[32m"
+	blue    = "\x1b[34m"
+)
+
+func TestColor(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		opts     []jtoh.Option
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "FieldsHaveDistinctColors",
+			selector: ":ts:severity:msg",
+			input:    []string{`{"ts":"10:00","severity":"INFO","msg":"hi"}`},
+			want:     []string{cyan + "10:00" + reset + ":" + green + "INFO" + reset + ":" + blue + "hi" + reset},
+		},
+		{
+			name:     "LinesColoredBySeverity",
+			selector: ":severity:msg",
+			input: []string{
+				`{"severity":"ERROR","msg":"failed"}`,
+				`{"severity":"WARNING","msg":"slow"}`,
+				`{"level":"debug","msg":"details"}`,
+				`{"level":"fatal","msg":"bye"}`,
+				`{"severity":"CRITICAL","msg":"bye"}`,
+			},
+			want: []string{
+				red + "ERROR" + reset + ":" + red + "failed" + reset,
+				yellow + "WARNING" + reset + ":" + yellow + "slow" + reset,
+				dim + "<jtoh:missing field \"severity\">" + reset + ":" + dim + "details" + reset,
+				boldRed + "<jtoh:missing field \"severity\">" + reset + ":" + boldRed + "bye" + reset,
+				boldRed + "CRITICAL" + reset + ":" + boldRed + "bye" + reset,
+			},
+		},
+		{
+			name:     "NumericSeverities",
+			selector: ":msg",
+			input: []string{
+				`{"level":50,"msg":"error"}`,
+				`{"level":40,"msg":"warn"}`,
+				`{"level":30,"msg":"info"}`,
+			},
+			want: []string{
+				red + "error" + reset,
+				yellow + "warn" + reset,
+				cyan + "info" + reset,
+			},
+		},
+		{
+			name:     "ConfiguredSeverityField",
+			selector: ":msg",
+			opts:     []jtoh.Option{jtoh.WithSeverityField(mustParse(t, "log.lvl"))},
+			input: []string{
+				`{"severity":"INFO","log":{"lvl":"error"},"msg":"failed"}`,
+			},
+			want: []string{red + "failed" + reset},
+		},
+		{
+			name:     "NonJSONIsDimmed",
+			selector: ":msg",
+			input:    []string{"panic: oops", "", "  at main.go", `{"msg":"hi"}`},
+			want:     []string{dim + "panic: oops" + reset, "", dim + "  at main.go" + reset, cyan + "hi" + reset},
+		},
+		{
+			name:     "EmptyFieldsAreNotColored",
+			selector: ":msg:user",
+			input:    []string{`{"msg":"","user":"x"}`},
+			want:     []string{":" + green + "x" + reset},
+		},
+		{
+			name:     "TableIsAlignedWithoutColors",
+			selector: ":severity:msg",
+			opts:     []jtoh.Option{jtoh.WithOutput(jtoh.TableFormat)},
+			input: []string{
+				`{"severity":"INFO","msg":"hi"}`,
+				`{"severity":"ERROR","msg":"failed"}`,
+			},
+			want: []string{
+				"severity  msg",
+				cyan + "INFO" + reset + "      " + green + "hi" + reset,
+				red + "ERROR" + reset + "     " + red + "failed" + reset,
+			},
+		},
+		{
+			name:     "OtherFormatsAreNotColored",
+			selector: ":severity:msg",
+			opts:     []jtoh.Option{jtoh.WithOutput(jtoh.CSVFormat)},
+			input:    []string{"panic", `{"severity":"ERROR","msg":"failed"}`},
+			want:     []string{"panic,", "ERROR,failed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]jtoh.Option{jtoh.WithColor()}, test.opts...)
+			j, err := jtoh.New(test.selector, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(strings.Join(test.input, "\n")), output)
+
+			want := strings.Join(test.want, "\n") + "\n"
+			if output.String() != want {
+				t.Errorf("got:\n%q\nwant:\n%q", output.String(), want)
+			}
+		})
+	}
+}
+
+func TestColorOnTemplate(t *testing.T) {
+	j, err := jtoh.NewTemplate(`{{.severity}} {{.msg}}`, jtoh.WithColor())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(`{"severity":"INFO","msg":"hi"}{"severity":"ERROR","msg":"failed"}`), output)
+
+	want := "INFO hi\n" + red + "ERROR failed" + reset + "\n"
+	if output.String() != want {
+		t.Errorf("got %q; want %q", output.String(), want)
+	}
+}
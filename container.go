@@ -0,0 +1,151 @@
+package jtoh
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Names of the pseudo-fields set from the container runtime log formats.
+const (
+	timestampField = "_ts"
+	streamField    = "_stream"
+)
+
+// Tags of the CRI log lines, long lines are split on many
+// partial lines, with the last one being a full line.
+const (
+	criFull    = "F"
+	criPartial = "P"
+)
+
+// WithContainerLogs configures the transformer to handle the formats
+// used by container runtimes to store logs, so the logs written by the
+// containers are transformed instead of the lines wrapping them:
+//
+// CRI (like the files under /var/log/pods), where each line is prefixed
+// by a timestamp, the stream and a tag:
+//
+// 2024-01-01T00:00:00.000000000Z stdout F {"msg":"started"}
+//
+// kubectl logs --timestamps, where each line is prefixed by a timestamp:
+//
+// 2024-01-01T00:00:00.000000000Z {"msg":"started"}
+//
+// Docker json-file, where each line is wrapped on a JSON object:
+//
+// {"log":"{\"msg\":\"started\"}\n","stream":"stdout","time":"2024-01-01T00:00:00Z"}
+//
+// The timestamp and stream are available as the "_ts" and "_stream"
+// fields. Logs that are not JSON (or logfmt) are echoed, Docker logs
+// are echoed without the wrapping object, with the timestamp and the
+// stream before them (like "2024-01-01T00:00:00Z stdout started").
+func WithContainerLogs() Option {
+	return func(j *J) {
+		j.containerLogs = true
+	}
+}
+
+// cutContainerPrefix removes the CRI or kubectl --timestamps prefix
+// from the line, returning the rest of the line and the fields of the
+// prefix. It returns false if the line has no prefix.
+func cutContainerPrefix(line []byte) ([]byte, map[string]interface{}, bool) {
+	if ts, stream, tag, content, ok := parseCRILine(line); ok && tag == criFull {
+		return content, map[string]interface{}{
+			timestampField: ts,
+			streamField:    stream,
+		}, true
+	}
+
+	ts, rest := cutPrefixField(line)
+	if !isTimestamp(ts) {
+		return nil, nil, false
+	}
+	return rest, map[string]interface{}{timestampField: string(ts)}, true
+}
+
+// parseCRILine parses a line on the CRI log format, returning
+// its timestamp, stream, tag and content.
+func parseCRILine(line []byte) (string, string, string, []byte, bool) {
+	ts, rest := cutPrefixField(line)
+	stream, rest := cutPrefixField(rest)
+	tag, content := cutPrefixField(rest)
+	if !isTimestamp(ts) || !isStream(string(stream)) {
+		return "", "", "", nil, false
+	}
+	if string(tag) != criFull && string(tag) != criPartial {
+		return "", "", "", nil, false
+	}
+	return string(ts), string(stream), string(tag), content, true
+}
+
+// cutPrefixField returns the data until the first space and the data
+// after it. The space before a JSON object is not on the line given
+// by the passthrough, so it is optional at the end of the data.
+func cutPrefixField(data []byte) ([]byte, []byte) {
+	field, rest, _ := bytes.Cut(data, []byte{' '})
+	return field, rest
+}
+
+// unwrapDockerLog returns the log and the fields of
+// a Docker json-file entry, or false if obj is not one.
+func unwrapDockerLog(obj map[string]interface{}) (string, map[string]interface{}, bool) {
+	log, stream, ts, ok := dockerEntry(obj)
+	if !ok {
+		return "", nil, false
+	}
+	log = strings.TrimSuffix(log, "\n")
+	log = strings.TrimSuffix(log, "\r")
+	return log, map[string]interface{}{
+		timestampField: ts,
+		streamField:    stream,
+	}, true
+}
+
+// dockerTextLine returns the line echoed for a Docker log that is
+// not JSON (or logfmt), so its timestamp and stream are not lost.
+func dockerTextLine(log string, fields map[string]interface{}) string {
+	return fmt.Sprintf("%v %v %s", fields[timestampField], fields[streamField], log)
+}
+
+// dockerEntry returns the log, stream and timestamp of
+// a Docker json-file entry, or false if obj is not one.
+func dockerEntry(obj map[string]interface{}) (string, string, string, bool) {
+	log, ok := obj["log"].(string)
+	if !ok {
+		return "", "", "", false
+	}
+	stream, ok := obj["stream"].(string)
+	if !ok || !isStream(stream) {
+		return "", "", "", false
+	}
+	ts, ok := obj["time"].(string)
+	if !ok || !isTimestamp([]byte(ts)) {
+		return "", "", "", false
+	}
+	for key := range obj {
+		switch key {
+		case "log", "stream", "time", "attrs":
+		default:
+			return "", "", "", false
+		}
+	}
+	return log, stream, ts, true
+}
+
+func isTimestamp(ts []byte) bool {
+	_, err := time.Parse(time.RFC3339Nano, string(ts))
+	return err == nil
+}
+
+func isStream(stream string) bool {
+	return stream == "stdout" || stream == "stderr"
+}
+
+// setFields sets the fields on obj.
+func setFields(obj, fields map[string]interface{}) {
+	for name, v := range fields {
+		obj[name] = v
+	}
+}
@@ -0,0 +1,144 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestContainerLogs(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		logfmt   jtoh.LogfmtMode
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "CRI",
+			selector: ":_ts:_stream:msg",
+			input: []string{
+				`2024-01-01T00:00:00.123456789Z stdout F {"msg":"first"}`,
+				`2024-01-01T00:00:01Z stderr F {"msg":"second"}`,
+			},
+			want: []string{
+				"2024-01-01T00:00:00.123456789Z:stdout:first",
+				"2024-01-01T00:00:01Z:stderr:second",
+			},
+		},
+		{
+			name:     "CRIWithText",
+			selector: ":_ts:msg",
+			input: []string{
+				`2024-01-01T00:00:00Z stdout F {"msg":"first"}`,
+				`2024-01-01T00:00:01Z stderr F panic: boom`,
+				`2024-01-01T00:00:02Z stdout F {"msg":"second"}`,
+			},
+			want: []string{
+				"2024-01-01T00:00:00Z:first",
+				"",
+				"2024-01-01T00:00:01Z stderr F panic: boom",
+				"2024-01-01T00:00:02Z:second",
+			},
+		},
+		{
+			name:     "CRIWithLogfmt",
+			selector: ":_ts:_stream:level:msg",
+			input: []string{
+				`2024-01-01T00:00:00Z stdout F level=info msg="logfmt line"`,
+			},
+			want: []string{"2024-01-01T00:00:00Z:stdout:info:logfmt line"},
+		},
+		{
+			name:     "CRIWithLogfmtOff",
+			selector: ":_ts:msg",
+			logfmt:   jtoh.LogfmtOff,
+			input: []string{
+				`{"msg":"first"}`,
+				`2024-01-01T00:00:00Z stdout F {"msg":"second"}`,
+				`2024-01-01T00:00:00Z stdout F {"msg":"third"}`,
+			},
+			want: []string{
+				`<jtoh:missing field "_ts">:first`,
+				"2024-01-01T00:00:00Z:second",
+				"2024-01-01T00:00:00Z:third",
+			},
+		},
+		{
+			name:     "Kubectl",
+			selector: ":_ts:_stream:msg",
+			input: []string{
+				`2024-01-01T00:00:00.5Z {"msg":"first"}`,
+				`2024-01-01T00:00:01+02:00 {"msg":"second"}`,
+			},
+			want: []string{
+				`2024-01-01T00:00:00.5Z:<jtoh:missing field "_stream">:first`,
+				`2024-01-01T00:00:01+02:00:<jtoh:missing field "_stream">:second`,
+			},
+		},
+		{
+			name:     "Docker",
+			selector: ":_ts:_stream:level:msg",
+			input: []string{
+				`{"log":"{\"level\":\"info\",\"msg\":\"json\"}\n","stream":"stdout","time":"2024-01-01T00:00:00.1Z"}`,
+				`{"log":"level=warn msg=logfmt\n","stream":"stderr","time":"2024-01-01T00:00:01Z"}`,
+				`{"log":"plain text\r\n","stream":"stderr","time":"2024-01-01T00:00:02Z"}`,
+				`{"log":"{\"msg\":\"trailing data\"} extra\n","stream":"stdout","time":"2024-01-01T00:00:03Z"}`,
+			},
+			want: []string{
+				"2024-01-01T00:00:00.1Z:stdout:info:json",
+				"2024-01-01T00:00:01Z:stderr:warn:logfmt",
+				"2024-01-01T00:00:02Z stderr plain text",
+				`2024-01-01T00:00:03Z stdout {"msg":"trailing data"} extra`,
+			},
+		},
+		{
+			name:     "NotContainerLogs",
+			selector: ":log:msg",
+			input: []string{
+				`{"log":"not docker","stream":"stdout","time":"2024-01-01T00:00:00Z","msg":"other field"}`,
+				`{"log":"not docker","stream":"stdin","time":"2024-01-01T00:00:00Z"}`,
+				`2024-01-01 00:00:00 {"msg":"not a timestamp prefix"}`,
+			},
+			want: []string{
+				"not docker:other field",
+				`not docker:<jtoh:missing field "msg">`,
+				"",
+				"2024-01-01 00:00:00",
+				`<jtoh:missing field "log">:not a timestamp prefix`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := strings.Join(test.input, "\n")
+			testTransform(t, input, test.selector, test.want, nil,
+				jtoh.WithContainerLogs(), jtoh.WithLogfmt(test.logfmt))
+		})
+	}
+}
+
+func TestContainerLogsAreNotHandledByDefault(t *testing.T) {
+	j, err := jtoh.New(":msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`2024-01-01T00:00:00Z stdout F {"msg":"cri"}`,
+		`{"log":"{\"msg\":\"docker\"}\n","stream":"stdout","time":"2024-01-01T00:00:00Z"}`,
+	}, "\n")
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(input), output)
+
+	want := "2024-01-01T00:00:00Z stdout F\ncri\n<jtoh:missing field \"msg\">\n"
+	if output.String() != want {
+		t.Errorf("got %q want %q", output.String(), want)
+	}
+}
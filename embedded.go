@@ -0,0 +1,47 @@
+package jtoh
+
+import "bytes"
+
+// prefixField is the name of the pseudo-field with the text
+// before a JSON object embedded on a text line.
+const prefixField = "_prefix"
+
+// WithEmbeddedJSON configures the transformer to handle JSON objects
+// embedded on the middle of text lines, like:
+//
+// 2024-01-01 INFO handler.go:42 {"user":"ed","status":200}
+//
+// The object is transformed and the text before it, that would be echoed
+// otherwise, is available as the "_prefix" field (without the leading
+// and trailing spaces). Any text after the object is still echoed.
+func WithEmbeddedJSON() Option {
+	return func(j *J) {
+		j.embeddedJSON = true
+	}
+}
+
+// linePrefix returns the fields of the text before a JSON object on the
+// same line, like the container runtime prefix. It returns false if the
+// text must be echoed, or if there is no text.
+func (j J) linePrefix(line []byte) (map[string]interface{}, bool) {
+	if len(line) == 0 || (!j.containerLogs && !j.embeddedJSON) {
+		return nil, false
+	}
+
+	fields := map[string]interface{}{}
+	if j.containerLogs {
+		if rest, prefixFields, ok := cutContainerPrefix(line); ok {
+			line, fields = rest, prefixFields
+		}
+	}
+
+	prefix := bytes.TrimSpace(line)
+	if len(prefix) == 0 {
+		return fields, len(fields) > 0
+	}
+	if !j.embeddedJSON {
+		return nil, false
+	}
+	fields[prefixField] = string(prefix)
+	return fields, true
+}
@@ -0,0 +1,102 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestEmbeddedJSON(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		opts     []jtoh.Option
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "Prefix",
+			selector: ":_prefix:user",
+			input: []string{
+				`2024-01-01 INFO handler.go:42 {"user":"ed"}`,
+				`2024-01-01 WARN  handler.go:50   {"user":"sam"}`,
+			},
+			want: []string{
+				"2024-01-01 INFO handler.go:42:ed",
+				"2024-01-01 WARN  handler.go:50:sam",
+			},
+		},
+		{
+			name:     "MixedWithJSONAndText",
+			selector: ":_prefix?=none:user",
+			input: []string{
+				`{"user":"ed"}`,
+				`plain text`,
+				`INFO {"user":"sam"}`,
+				`{"user":"bob"}`,
+			},
+			want: []string{
+				"none:ed",
+				"",
+				"plain text",
+				"INFO:sam",
+				"none:bob",
+			},
+		},
+		{
+			name:     "TextAfterObjectIsEchoed",
+			selector: ":_prefix:user",
+			input:    []string{`INFO {"user":"ed"} done`},
+			want: []string{
+				"INFO:ed",
+				" done",
+			},
+		},
+		{
+			name:     "NotValidObjectIsEchoed",
+			selector: ":_prefix:user",
+			input:    []string{`INFO {"user":ed}`},
+			want:     []string{`INFO {"user":ed}`},
+		},
+		{
+			name:     "WithContainerLogs",
+			selector: ":_ts:_prefix:user",
+			opts:     []jtoh.Option{jtoh.WithContainerLogs()},
+			input: []string{
+				`2024-01-01T00:00:00Z stdout F INFO handler.go:42 {"user":"ed"}`,
+				`2024-01-01T00:00:01Z stdout F {"user":"sam","_prefix":"none"}`,
+			},
+			want: []string{
+				"2024-01-01T00:00:00Z:INFO handler.go:42:ed",
+				"2024-01-01T00:00:01Z:none:sam",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := strings.Join(test.input, "\n")
+			opts := append([]jtoh.Option{jtoh.WithEmbeddedJSON()}, test.opts...)
+			testTransform(t, input, test.selector, test.want, nil, opts...)
+		})
+	}
+}
+
+func TestEmbeddedJSONIsNotHandledByDefault(t *testing.T) {
+	j, err := jtoh.New(":_prefix:user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(`INFO {"user":"ed"}`), output)
+
+	want := "INFO\n" + `<jtoh:missing field "_prefix">:ed` + "\n"
+	if output.String() != want {
+		t.Errorf("got %q want %q", output.String(), want)
+	}
+}
@@ -0,0 +1,579 @@
+package jtoh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed filter expression that is used to select which
+// JSON objects are transformed, for example:
+//
+// severity == "ERROR" && httpRequest.status >= 500
+//
+// Fields are referenced using the same path syntax of selectors
+// (fallbacks and defaults are not supported) and can be compared with
+// string, number, boolean and null literals or with other fields using:
+//
+//	==, !=          equality
+//	<, <=, >, >=    numeric comparison (lexicographic for strings)
+//	=~, !~          regular expression match (the right side must be a string)
+//
+// A field on its own checks if the field exists, and expressions
+// can be combined with "&&", "||", "!" and parenthesis.
+//
+// When a field matches multiple values (like with wildcards) a comparison
+// is true if any value satisfies it. Comparisons with missing fields are
+// always false, but since "!=" and "!~" are the negation of "==" and "=~"
+// they are true for missing fields.
+type Filter struct {
+	raw  string
+	root filterNode
+}
+
+// FilterErr is the error returned when parsing an invalid filter,
+// it indicates the column (starting at 1) of the offending token.
+// It wraps InvalidFilterErr, so errors.Is can be used to check for it.
+type FilterErr struct {
+	Filter string
+	Column int
+	Reason string
+}
+
+// ParseFilter parses the given filter expression.
+// If the filter is invalid it returns a *FilterErr.
+func ParseFilter(filter string) (Filter, error) {
+	p := filterParser{raw: filter}
+	if err := p.tokenize(); err != nil {
+		return Filter{}, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return Filter{}, err
+	}
+	if tok := p.peek(); tok.kind != eofToken {
+		return Filter{}, p.errorf(tok.column, "unexpected %q", tok.text)
+	}
+	return Filter{raw: filter, root: root}, nil
+}
+
+// String returns the filter as it was parsed.
+func (f Filter) String() string {
+	return f.raw
+}
+
+// Match returns true if the given object satisfies the filter.
+func (f Filter) Match(obj map[string]interface{}) bool {
+	if f.root == nil {
+		return true
+	}
+	return f.root.match(obj)
+}
+
+func (e *FilterErr) Error() string {
+	return fmt.Sprintf("%v:%s:column %d:%s", InvalidFilterErr, e.Filter, e.Column, e.Reason)
+}
+
+// Unwrap returns InvalidFilterErr.
+func (e *FilterErr) Unwrap() error {
+	return InvalidFilterErr
+}
+
+type filterNode interface {
+	match(obj map[string]interface{}) bool
+}
+
+type orNode struct {
+	left, right filterNode
+}
+
+type andNode struct {
+	left, right filterNode
+}
+
+type notNode struct {
+	node filterNode
+}
+
+type existsNode struct {
+	path path
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+	re          *regexp.Regexp
+}
+
+// operand is either a field path or a literal value.
+type operand struct {
+	path    *path
+	literal interface{}
+}
+
+func (n orNode) match(obj map[string]interface{}) bool {
+	return n.left.match(obj) || n.right.match(obj)
+}
+
+func (n andNode) match(obj map[string]interface{}) bool {
+	return n.left.match(obj) && n.right.match(obj)
+}
+
+func (n notNode) match(obj map[string]interface{}) bool {
+	return !n.node.match(obj)
+}
+
+func (n existsNode) match(obj map[string]interface{}) bool {
+	_, ok := n.path.selectValue(obj)
+	return ok
+}
+
+func (n compareNode) match(obj map[string]interface{}) bool {
+	switch n.op {
+	case "!=":
+		return !n.any(obj, "==")
+	case "!~":
+		return !n.any(obj, "=~")
+	}
+	return n.any(obj, n.op)
+}
+
+// any returns true if any of the left values satisfies
+// the comparison with any of the right values.
+func (n compareNode) any(obj map[string]interface{}, op string) bool {
+	rightValues := n.right.values(obj)
+	for _, l := range n.left.values(obj) {
+		if op == "=~" {
+			if s, ok := l.(string); ok && n.re.MatchString(s) {
+				return true
+			}
+			continue
+		}
+		for _, r := range rightValues {
+			if compare(op, l, r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o operand) values(obj map[string]interface{}) []interface{} {
+	if o.path == nil {
+		return []interface{}{o.literal}
+	}
+	v, ok := o.path.selectValue(obj)
+	if !ok {
+		return nil
+	}
+	if o.path.multi {
+		return v.([]interface{})
+	}
+	return []interface{}{v}
+}
+
+func compare(op string, l, r interface{}) bool {
+	if ln, ok := toNumber(l); ok {
+		rn, ok := toNumber(r)
+		if !ok {
+			return false
+		}
+		c, ok := compareNumbers(ln, rn)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return c == 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		}
+		return false
+	}
+
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return ls == rs
+		case "<":
+			return ls < rs
+		case "<=":
+			return ls <= rs
+		case ">":
+			return ls > rs
+		case ">=":
+			return ls >= rs
+		}
+		return false
+	}
+
+	switch l.(type) {
+	case bool, nil:
+		return op == "==" && l == r
+	}
+	return false
+}
+
+// toNumber returns the number as a json.Number, numbers on decoded
+// objects are json.Number but float64 is also accepted.
+func toNumber(v interface{}) (json.Number, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n, true
+	case float64:
+		return json.Number(strconv.FormatFloat(n, 'g', -1, 64)), true
+	}
+	return "", false
+}
+
+// compareNumbers returns -1, 0 or 1 if l is less, equal or greater
+// than r. Integers are compared exactly, other numbers as float64.
+func compareNumbers(l, r json.Number) (int, bool) {
+	if li, err := l.Int64(); err == nil {
+		if ri, err := r.Int64(); err == nil {
+			switch {
+			case li < ri:
+				return -1, true
+			case li > ri:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	lf, err := l.Float64()
+	if err != nil {
+		return 0, false
+	}
+	rf, err := r.Float64()
+	if err != nil {
+		return 0, false
+	}
+	switch {
+	case lf < rf:
+		return -1, true
+	case lf > rf:
+		return 1, true
+	}
+	return 0, true
+}
+
+type filterTokenKind int
+
+const (
+	eofToken filterTokenKind = iota
+	pathToken
+	stringToken
+	numberToken
+	keywordToken
+	opToken
+)
+
+type filterToken struct {
+	kind   filterTokenKind
+	text   string
+	column int
+}
+
+type filterParser struct {
+	raw    string
+	tokens []filterToken
+	pos    int
+}
+
+// operators are ordered so longer operators are matched first.
+var filterOperators = []string{
+	"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")",
+}
+
+const filterOperatorChars = "=!<>&|()"
+
+func (p *filterParser) tokenize() error {
+	src := []rune(p.raw)
+	pos := 0
+
+	for pos < len(src) {
+		c := src[pos]
+		column := pos + 1
+
+		if c < 0x80 && isSpace(byte(c)) {
+			pos++
+			continue
+		}
+
+		if strings.ContainsRune(filterOperatorChars, c) {
+			op := ""
+			for _, candidate := range filterOperators {
+				if hasPrefix(src[pos:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return p.errorf(column, "invalid operator %q", c)
+			}
+			p.tokens = append(p.tokens, filterToken{kind: opToken, text: op, column: column})
+			pos += len(op)
+			continue
+		}
+
+		start := pos
+		kind := pathToken
+
+		switch {
+		case c == '"' || c == '`':
+			kind = stringToken
+			pos++
+			for pos < len(src) && src[pos] != c {
+				if src[pos] == '\\' && c == '"' {
+					pos++
+				}
+				pos++
+			}
+			if pos >= len(src) {
+				return p.errorf(column, "unclosed string")
+			}
+			pos++
+		case isDigit(c) || (c == '-' && pos+1 < len(src) && (isDigit(src[pos+1]) || src[pos+1] == '.')):
+			kind = numberToken
+			pos++
+			for pos < len(src) && (isDigit(src[pos]) || strings.ContainsRune(".eE+-", src[pos])) {
+				pos++
+			}
+		default:
+			pos = pathEnd(src, pos)
+		}
+
+		text := string(src[start:pos])
+		if kind == pathToken && (text == "true" || text == "false" || text == "null") {
+			kind = keywordToken
+		}
+		p.tokens = append(p.tokens, filterToken{kind: kind, text: text, column: column})
+	}
+
+	p.tokens = append(p.tokens, filterToken{kind: eofToken, text: "end of filter", column: len(src) + 1})
+	return nil
+}
+
+// pathEnd finds where a path that starts on the given position ends,
+// which is the first space or operator that is not quoted,
+// escaped or inside brackets. The "->" operator is part of the path.
+func pathEnd(src []rune, pos int) int {
+	var (
+		depth   int
+		quoted  bool
+		escaped bool
+	)
+	for ; pos < len(src); pos++ {
+		c := src[pos]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case depth > 0:
+		case hasPrefix(src[pos:], jsonOperator):
+			pos++
+		case c < 0x80 && isSpace(byte(c)), strings.ContainsRune(filterOperatorChars, c):
+			return pos
+		}
+	}
+	return pos
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (filterNode, error) {
+	if p.acceptOp("!") {
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	}
+
+	if open := p.peek(); p.acceptOp("(") {
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptOp(")") {
+			return nil, p.errorf(open.column, "unclosed '('")
+		}
+		return node, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (filterNode, error) {
+	leftTok := p.peek()
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	opTok := p.peek()
+	op := opTok.text
+	switch {
+	case opTok.kind != opToken:
+		op = ""
+	case op == "==", op == "!=", op == "<", op == "<=", op == ">", op == ">=", op == "=~", op == "!~":
+		p.next()
+	default:
+		op = ""
+	}
+
+	if op == "" {
+		if left.path == nil {
+			return nil, p.errorf(leftTok.column, "expected a field or a comparison, got %q", leftTok.text)
+		}
+		return existsNode{path: *left.path}, nil
+	}
+
+	rightTok := p.peek()
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	node := compareNode{op: op, left: left, right: right}
+	if op == "=~" || op == "!~" {
+		pattern, ok := right.literal.(string)
+		if right.path != nil || !ok {
+			return nil, p.errorf(rightTok.column, "regular expression must be a string")
+		}
+		node.re, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, p.errorf(rightTok.column, "invalid regular expression: %v", err)
+		}
+	}
+	return node, nil
+}
+
+func (p *filterParser) operand() (operand, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case stringToken:
+		s, err := strconv.Unquote(tok.text)
+		if err != nil {
+			return operand{}, p.errorf(tok.column, "invalid string %s", tok.text)
+		}
+		return operand{literal: s}, nil
+	case numberToken:
+		if _, err := strconv.ParseFloat(tok.text, 64); err != nil {
+			return operand{}, p.errorf(tok.column, "invalid number %s", tok.text)
+		}
+		return operand{literal: json.Number(tok.text)}, nil
+	case keywordToken:
+		switch tok.text {
+		case "true":
+			return operand{literal: true}, nil
+		case "false":
+			return operand{literal: false}, nil
+		}
+		return operand{literal: nil}, nil
+	case pathToken:
+		sp := selectorParser{
+			src:    []rune(tok.text),
+			full:   p.raw,
+			offset: tok.column - 1,
+		}
+		steps, err := sp.path()
+		if err != nil {
+			var selErr *SelectorErr
+			if errors.As(err, &selErr) {
+				return operand{}, p.errorf(selErr.Column, "invalid field %q: %s", tok.text, selErr.Reason)
+			}
+			return operand{}, err
+		}
+		if !sp.eof() {
+			return operand{}, p.errorf(tok.column+sp.pos, "unexpected %q", sp.peek())
+		}
+		pth := newPath(steps)
+		return operand{path: &pth}, nil
+	}
+
+	return operand{}, p.errorf(tok.column, "expected a field or a value, got %q", tok.text)
+}
+
+func (p *filterParser) acceptOp(op string) bool {
+	if tok := p.peek(); tok.kind == opToken && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != eofToken {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) errorf(column int, format string, args ...interface{}) error {
+	return &FilterErr{
+		Filter: p.raw,
+		Column: column,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
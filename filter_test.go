@@ -0,0 +1,182 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestFilter(t *testing.T) {
+	type Test struct {
+		name   string
+		filter string
+		input  string
+		want   bool
+	}
+
+	const input = `{
+		"severity": "ERROR",
+		"msg": "connection refused",
+		"httpRequest": {"status": 503, "latency": 0.25},
+		"labels": {"app.kubernetes.io/name": "api"},
+		"tags": ["db", "retry"],
+		"retried": true,
+		"user": null,
+		"traceId": 1594600000000000123,
+		"exp": 1.5e3,
+		"payload": "{\"level\":\"warn\",\"code\":42}"
+	}`
+
+	tests := []Test{
+		{name: "StringEquality", filter: `severity == "ERROR"`, want: true},
+		{name: "StringEqualityNoMatch", filter: `severity == "INFO"`, want: false},
+		{name: "StringInequality", filter: `severity != "INFO"`, want: true},
+		{name: "NumberEquality", filter: `httpRequest.status == 503`, want: true},
+		{name: "NumberGreaterOrEqual", filter: `httpRequest.status >= 500`, want: true},
+		{name: "NumberGreater", filter: `httpRequest.status > 503`, want: false},
+		{name: "NumberLess", filter: `httpRequest.latency < 0.5`, want: true},
+		{name: "NumberLessOrEqual", filter: `httpRequest.latency <= 0.1`, want: false},
+		{name: "NegativeNumber", filter: `httpRequest.status > -1`, want: true},
+		{name: "BigIntegerEquality", filter: `traceId == 1594600000000000123`, want: true},
+		{name: "BigIntegerIsExact", filter: `traceId == 1594600000000000124`, want: false},
+		{name: "BigIntegerGreater", filter: `traceId > 1594600000000000122`, want: true},
+		{name: "NumberWithExponent", filter: `exp == 1500`, want: true},
+		{name: "NumberWithDifferentNotation", filter: `httpRequest.latency == 2.5e-1`, want: true},
+		{name: "StringComparison", filter: `severity > "DEBUG"`, want: true},
+		{name: "NumberWithString", filter: `httpRequest.status == "503"`, want: false},
+		{name: "BoolEquality", filter: `retried == true`, want: true},
+		{name: "NullEquality", filter: `user == null`, want: true},
+		{name: "RegexMatch", filter: `msg =~ "refused|timeout"`, want: true},
+		{name: "RegexNoMatch", filter: `msg =~ "^timeout"`, want: false},
+		{name: "RegexNegatedMatch", filter: `msg !~ "^timeout"`, want: true},
+		{name: "RegexRawString", filter: "msg =~ `\\bconn\\w+`", want: true},
+		{name: "RegexOnNonString", filter: `httpRequest.status =~ "5.."`, want: false},
+		{name: "Exists", filter: `httpRequest.status`, want: true},
+		{name: "ExistsNullValue", filter: `user`, want: true},
+		{name: "NotExists", filter: `!trace`, want: true},
+		{name: "EmbeddedJSON", filter: `payload->level == "warn"`, want: true},
+		{name: "EmbeddedJSONNumber", filter: `payload->code>40&&payload->code<50`, want: true},
+		{name: "EmbeddedJSONMissing", filter: `payload->msg`, want: false},
+		{name: "MissingFieldComparison", filter: `trace == "abc"`, want: false},
+		{name: "MissingFieldInequality", filter: `trace != "abc"`, want: true},
+		{name: "And", filter: `severity == "ERROR" && httpRequest.status >= 500`, want: true},
+		{name: "AndNoMatch", filter: `severity == "ERROR" && httpRequest.status < 500`, want: false},
+		{name: "Or", filter: `severity == "INFO" || httpRequest.status >= 500`, want: true},
+		{name: "AndHasPrecedenceOverOr", filter: `severity == "INFO" && trace || retried`, want: true},
+		{name: "Parenthesis", filter: `severity == "INFO" && (trace || retried)`, want: false},
+		{name: "NegatedParenthesis", filter: `!(severity == "INFO" || trace)`, want: true},
+		{name: "NoSpaces", filter: `severity=="ERROR"&&httpRequest.status>=500`, want: true},
+		{name: "QuotedKey", filter: `labels."app.kubernetes.io/name" == "api"`, want: true},
+		{name: "ArrayIndex", filter: `tags[0] == "db"`, want: true},
+		{name: "WildcardMatchesAny", filter: `tags.* == "retry"`, want: true},
+		{name: "RecursiveDescent", filter: `..status == 503`, want: true},
+		{name: "FieldWithField", filter: `severity == severity`, want: true},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := jtoh.ParseFilter(test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error [%v]", err)
+			}
+			if got := filter.String(); got != test.filter {
+				t.Errorf("String(): got %q want %q", got, test.filter)
+			}
+
+			j, err := jtoh.New(":severity", jtoh.WithFilter(filter))
+			if err != nil {
+				t.Fatalf("unexpected error [%v]", err)
+			}
+
+			output := bytes.Buffer{}
+			j.Do(strings.NewReader(input), &output)
+
+			got := output.String() == "ERROR\n"
+			if !got && output.Len() > 0 {
+				t.Fatalf("unexpected output %q", output.String())
+			}
+			if got != test.want {
+				t.Errorf("filter %q: got match %t want %t", test.filter, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterKeepsEchoingNonJSON(t *testing.T) {
+	filter, err := jtoh.ParseFilter(`n >= 2`)
+	if err != nil {
+		t.Fatalf("unexpected error [%v]", err)
+	}
+	j, err := jtoh.New(":n", jtoh.WithFilter(filter))
+	if err != nil {
+		t.Fatalf("unexpected error [%v]", err)
+	}
+
+	input := strings.Join([]string{
+		`{"n":1}`,
+		`plain message`,
+		`{"n":2}`,
+		`{"n":3}`,
+	}, "\n")
+
+	output := bytes.Buffer{}
+	j.Do(strings.NewReader(input), &output)
+
+	want := "\nplain message\n2\n3\n"
+	if got := output.String(); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	type Test struct {
+		filter     string
+		wantColumn int
+	}
+
+	tests := []Test{
+		{filter: ``, wantColumn: 1},
+		{filter: `severity ==`, wantColumn: 12},
+		{filter: `severity = "ERROR"`, wantColumn: 10},
+		{filter: `severity == "ERROR`, wantColumn: 13},
+		{filter: `(severity == "ERROR"`, wantColumn: 1},
+		{filter: `severity == "ERROR")`, wantColumn: 20},
+		{filter: `msg =~ "(unclosed"`, wantColumn: 8},
+		{filter: `msg =~ other`, wantColumn: 8},
+		{filter: `"value"`, wantColumn: 1},
+		{filter: `a && status == 1e`, wantColumn: 16},
+		{filter: `a && list[x] == 1`, wantColumn: 11},
+		{filter: `a & b`, wantColumn: 3},
+	}
+
+	for _, test := range tests {
+		_, err := jtoh.ParseFilter(test.filter)
+		if !errors.Is(err, jtoh.InvalidFilterErr) {
+			t.Errorf("filter %q: got err[%v] want[%v]", test.filter, err, jtoh.InvalidFilterErr)
+			continue
+		}
+
+		var filterErr *jtoh.FilterErr
+		if !errors.As(err, &filterErr) {
+			t.Errorf("filter %q: got err[%v] want a *jtoh.FilterErr", test.filter, err)
+			continue
+		}
+		if filterErr.Column != test.wantColumn {
+			t.Errorf("filter %q: got column %d want %d (err: %v)", test.filter, filterErr.Column, test.wantColumn, err)
+		}
+	}
+}
+
+func mustParseFilter(t *testing.T, filter string) jtoh.Filter {
+	t.Helper()
+
+	f, err := jtoh.ParseFilter(filter)
+	if err != nil {
+		t.Fatalf("ParseFilter(%q): unexpected error [%v]", filter, err)
+	}
+	return f
+}
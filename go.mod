@@ -1,5 +1,8 @@
 module github.com/madlambda/jtoh
 
-go 1.16
+go 1.22
 
-require github.com/madlambda/spells v0.1.0 // indirect
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/madlambda/spells v0.1.0
+)
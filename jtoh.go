@@ -2,24 +2,115 @@ package jtoh
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"text/template"
 )
 
 // J is a jtoh transformer, it transforms JSON into something more human
 type J struct {
 	separator      string
-	fieldSelectors []string
+	fieldSelectors []Selector
+	tmpl           *template.Template
+	filter         *Filter
+	stats          *Stats
+	chunkSize      int
+	flatten        bool
+	format         Format
+	header         bool
+	noHeader       bool
+	tableWindow    int
+	logfmt         LogfmtMode
+	color          bool
+	severity       *Selector
+	extraFields    map[string]interface{}
+	containerLogs  bool
+	embeddedJSON   bool
+	trailers       bool
+	// maxContainerLogSize is the maximum size of the
+	// container logs reassembled from partial lines.
+	maxContainerLogSize int
+	// maxTrailerSize is the maximum size of
+	// the lines grouped with a record.
+	maxTrailerSize int
 }
 
 // Err is an exported jtoh error
 type Err string
 
-// InvalidSelectorErr represents errors with the provided fields selector
-const InvalidSelectorErr Err = "invalid selector"
+const (
+	// InvalidSelectorErr represents errors with the provided fields selector
+	InvalidSelectorErr Err = "invalid selector"
+	// InvalidTemplateErr represents errors with the provided template
+	InvalidTemplateErr Err = "invalid template"
+	// InvalidFilterErr represents errors with the provided filter
+	InvalidFilterErr Err = "invalid filter"
+	// InvalidFormatErr represents errors with the provided output format
+	InvalidFormatErr Err = "invalid output format"
+	// InvalidLogfmtModeErr represents errors with the provided logfmt mode
+	InvalidLogfmtModeErr Err = "invalid logfmt mode"
+)
+
+// Option configures optional behavior of a jtoh transformer.
+type Option func(*J)
+
+// WithStats configures the transformer to add the counters of
+// what is processed to the given stats. The stats must not be
+// accessed until the transformation is done.
+func WithStats(s *Stats) Option {
+	return func(j *J) {
+		j.stats = s
+	}
+}
+
+// WithFilter configures the transformer to only transform JSON objects
+// that match the given filter. Data that is not JSON is still echoed.
+func WithFilter(f Filter) Option {
+	return func(j *J) {
+		j.filter = &f
+	}
+}
+
+// WithPassthroughChunkSize configures how much data that is not JSON
+// is buffered before being echoed. Non JSON data is echoed line by line,
+// so this only matters for lines larger than the chunk size, which are
+// echoed in chunks of the given size. The default is 64KB.
+func WithPassthroughChunkSize(size int) Option {
+	return func(j *J) {
+		j.chunkSize = size
+	}
+}
+
+// WithFlatten configures the transformer to render selected objects
+// and arrays as a list of key=value pairs, like "a=1 b.c=2 list[0]=x",
+// instead of compact JSON. With JSONFormat the selected values are
+// kept as JSON, but the selectors are used as keys instead of
+// nesting the fields.
+func WithFlatten() Option {
+	return func(j *J) {
+		j.flatten = true
+	}
+}
+
+// WithField configures the transformer to set a field with the given
+// name and value on all transformed records (replacing any field with
+// the same name), so it can be selected and filtered like any other.
+// It can be used many times to set multiple fields.
+func WithField(name string, value interface{}) Option {
+	return func(j *J) {
+		fields := map[string]interface{}{name: value}
+		for k, v := range j.extraFields {
+			if k != name {
+				fields[k] = v
+			}
+		}
+		j.extraFields = fields
+	}
+}
 
 // New creates a new jtoh transformer using the given selector.
 // The selector is on the form <separator><field selector 1><separator><field selector 2>
@@ -34,8 +125,60 @@ const InvalidSelectorErr Err = "invalid selector"
 // Making "." the only character that will not be allowed to be used
 // as a separator since it is already a selector for nested fields.
 //
-// If the selector is invalid it returns an error.
-func New(s string) (J, error) {
+// Keys that have characters used by the selector syntax (like ".")
+// can be quoted or have the characters escaped with a backslash:
+//
+// :labels."app.kubernetes.io/name":labels.app\.kubernetes\.io/name
+//
+// Elements of JSON arrays can be accessed by index, negative indexes
+// start from the end of the array:
+//
+// :spans[0].name:tags[-1]
+//
+// A slice of an array can also be selected, in which case
+// all selected values are rendered as a list:
+//
+// :items[1:3].id
+//
+// A "*" matches any field of an object (or any element of an array)
+// and ".." matches the field that follows it at any depth:
+//
+// :resource.labels.*:..error
+//
+// Wildcards also render all matched values as a list, while
+// a recursive descent selects the shallowest match.
+//
+// Strings with an embedded JSON document, like Docker's log or GCP's
+// textPayload, are decoded by "->", which is used instead of "." to
+// keep navigating inside the embedded document:
+//
+// :textPayload->msg:log->user.name:payload->
+//
+// Strings that are not valid JSON are missing fields.
+//
+// Selected objects and arrays are rendered as compact JSON, unless
+// WithFlatten is used.
+//
+// Alternative fields can be separated by "|", the first one that is
+// present is selected, and a default value can be provided with "?="
+// to be used instead of a missing field error:
+//
+// :message|msg|textPayload:user.id?=anonymous
+//
+// Numbers are rendered exactly as they are on the input, but they can
+// also be formatted with a fmt style directive introduced by "%",
+// which goes after the alternatives and before the default value:
+//
+// :latency%.2f:status%5d:id%x?=none
+//
+// Integer (d, x, X, o, b) and floating point (e, E, f, F, g, G) verbs,
+// with flags, width and precision, are supported. Values that are not
+// numbers are rendered as usual. To use a "%" on a key that would
+// be handled as a format, escape it with a backslash.
+//
+// If the selector is invalid it returns an error, when the problem is
+// on a field selector the error is a *SelectorErr indicating where.
+func New(s string, opts ...Option) (J, error) {
 	selector := []rune(s)
 	if len(selector) <= 1 {
 		return J{}, fmt.Errorf("%w:%s", InvalidSelectorErr, s)
@@ -44,10 +187,29 @@ func New(s string) (J, error) {
 	if separator == "." {
 		return J{}, fmt.Errorf("%w:can't use '.' as separator", InvalidSelectorErr)
 	}
-	return J{
+	fieldSelectors, err := parseSelectors(selector)
+	if err != nil {
+		return J{}, err
+	}
+	j := J{
 		separator:      separator,
-		fieldSelectors: trimSpaces(strings.Split(string(selector[1:]), separator)),
-	}, nil
+		fieldSelectors: fieldSelectors,
+	}
+	return j.with(opts), nil
+}
+
+// Stats has counters of what was processed by a jtoh transformer.
+type Stats struct {
+	// Records is the number of JSON objects (and logfmt lines) decoded.
+	Records int
+	// Filtered is how many of the decoded JSON objects
+	// were not transformed because they did not match the filter.
+	Filtered int
+	// NonJSON is the number of chunks of non JSON data that were echoed.
+	NonJSON int
+	// MissingFields is how many selected fields were missing
+	// on the transformed JSON objects.
+	MissingFields int
 }
 
 // Do receives a json stream as input and transforms it
@@ -55,189 +217,270 @@ func New(s string) (J, error) {
 // then written in the provided writer.
 //
 // This function will block until all data is read from the input
-// and written on the output.
+// and written on the output. Errors reading or writing data are
+// reported on stderr, use DoContext to handle them.
 func (j J) Do(jsonInput io.Reader, linesOutput io.Writer) {
-	jsonInput, ok := isList(jsonInput)
-	// Why not bufio ? what we need here is kinda like
-	// buffered io, but not exactly the same (was not able to
-	// come up with a better name to it).
-	bufinput := bufferedReader{r: jsonInput}
-	dec := json.NewDecoder(&bufinput)
-
-	if ok {
-		// WHY: To handle properly gigantic lists of JSON objs
-		// Really don't need the return value, but linters can be annoying =P
-		_, _ = dec.Token()
-		bufinput.reset()
-	}
-
-	var errBuffer []byte
-
-	// TODO: Right now we have space complexity O(N) when the input is not JSON
-	// For huge chunks of non JSON data this may be a problem
-	for bufinput.hasData() {
-		for dec.More() {
-			m := map[string]interface{}{}
-			err := dec.Decode(&m)
-			dataUsedOnDecode := bufinput.readBuffer()
-			bufinput.reset()
-
-			if err != nil {
-				errBuffer = append(errBuffer, dataUsedOnDecode...)
-				dec = json.NewDecoder(&bufinput)
-				continue
-			}
+	if err := j.DoContext(context.Background(), jsonInput, linesOutput); err != nil {
+		fmt.Fprintf(os.Stderr, "jtoh:error: %v\n", err)
+	}
+}
 
-			writeErrs(linesOutput, errBuffer)
-			errBuffer = nil
+// DoContext works just like Do, but it stops if the context is cancelled
+// and returns any error reading the input or writing the output.
+// When the input ends, with io.EOF, it returns nil.
+//
+// Cancellation is checked between reads and JSON objects, so a Read
+// that blocks forever will also block DoContext.
+func (j J) DoContext(ctx context.Context, jsonInput io.Reader, linesOutput io.Writer) error {
+	stats := &Stats{}
+	if j.stats != nil {
+		stats = j.stats
+	}
 
-			fieldValues := make([]string, len(j.fieldSelectors))
-			for i, fieldSelector := range j.fieldSelectors {
-				fieldValues[i] = selectField(fieldSelector, m)
+	if j.containerLogs {
+		jsonInput = newReassembler(jsonInput, j.maxContainerLogSize)
+	}
+	scan := newScanner(ctx, jsonInput)
+	enc := j.newEncoder(linesOutput)
+	if j.format == TableFormat {
+		// The first records of a table wait for the others on its
+		// window, they are written if the input stalls, so streams
+		// that are slow to have that many records are not stuck.
+		scan.stalled = enc.flush
+	}
+	echo := newPassthrough(linesOutput, j.chunkSize, enc, stats)
+	echo.dim = j.color && (j.format == TextFormat || j.format == TableFormat)
+
+	transform := func(obj map[string]interface{}) error {
+		setFields(obj, j.extraFields)
+		stats.Records++
+		if j.filter != nil && !j.filter.Match(obj) {
+			stats.Filtered++
+			return nil
+		}
+		if err := enc.record(j.project(obj, stats)); err != nil {
+			return err
+		}
+		if trailer, ok := obj[trailerField].(string); ok && j.trailers && j.format == TextFormat {
+			color := ""
+			if echo.dim {
+				color = colorDim
 			}
-			fmt.Fprint(linesOutput, strings.Join(fieldValues, j.separator)+"\n")
+			return writeTrailer(linesOutput, trailer, color)
 		}
-		dec = json.NewDecoder(&bufinput)
+		return nil
 	}
 
-	writeErrs(linesOutput, errBuffer)
-}
-
-func writeErrs(w io.Writer, errBuffer []byte) {
-	if len(errBuffer) == 0 {
-		return
+	// With trailers each record waits for the lines that continue
+	// it, and is transformed once a line doesn't.
+	group := newRecordGroup(j.maxTrailerSize)
+	endGroup := func() error {
+		obj, ok := group.end()
+		if !ok {
+			return nil
+		}
+		return transform(obj)
 	}
-	errBuffer = append(errBuffer, '\n')
-	n, err := w.Write(errBuffer)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "jtoh:error writing error buffer: wrote %d bytes, details: %v\n", n, err)
+	emit := func(obj map[string]interface{}, restOfLine bool) error {
+		if !j.trailers {
+			return transform(obj)
+		}
+		if err := endGroup(); err != nil {
+			return err
+		}
+		group.start(obj, restOfLine)
+		return nil
+	}
+	if j.trailers {
+		echo.beforeEcho = endGroup
 	}
-}
 
-func selectField(selector string, obj map[string]interface{}) string {
-	const accessOp = "."
+	if j.logfmt != LogfmtOff || j.trailers {
+		echo.handleLine = func(line []byte) (bool, error) {
+			if group.pending {
+				if group.add(line) {
+					return true, nil
+				}
+				if err := endGroup(); err != nil {
+					return false, err
+				}
+			}
 
-	fields := strings.Split(selector, accessOp)
-	pathFields := fields[0 : len(fields)-1]
-	finalField := fields[len(fields)-1]
+			var prefixFields map[string]interface{}
+			if j.containerLogs {
+				if rest, fields, ok := cutContainerPrefix(line); ok {
+					line, prefixFields = rest, fields
+				}
+			}
+			obj, ok := parseLogfmt(line, j.logfmt)
+			if !ok {
+				return false, nil
+			}
+			setFields(obj, prefixFields)
+			return true, emit(obj, false)
+		}
+	}
 
-	for _, pathField := range pathFields {
-		v, ok := obj[pathField]
-		if !ok {
-			return missingFieldErrMsg(selector)
+	// transformObject transforms a JSON object, unwrapping the Docker
+	// log entries, that are echoed if the log is not JSON or logfmt.
+	transformObject := func(obj map[string]interface{}) error {
+		if !j.containerLogs {
+			return emit(obj, true)
 		}
-		obj, ok = v.(map[string]interface{})
+		log, fields, ok := unwrapDockerLog(obj)
 		if !ok {
-			return missingFieldErrMsg(selector)
+			return emit(obj, true)
 		}
-	}
-
-	v, ok := obj[finalField]
-	if !ok {
-		return missingFieldErrMsg(selector)
-	}
 
-	return strings.Replace(fmt.Sprint(v), "\n", "\\n", -1)
-}
+		unwrapped := map[string]interface{}{}
+		if json.Valid([]byte(log)) && decodeObject([]byte(log), &unwrapped) == nil {
+			setFields(unwrapped, fields)
+			return emit(unwrapped, true)
+		}
+		if logfmtObj, ok := parseLogfmt([]byte(log), j.logfmt); ok {
+			setFields(logfmtObj, fields)
+			return emit(logfmtObj, true)
+		}
 
-func missingFieldErrMsg(selector string) string {
-	return fmt.Sprintf("<jtoh:missing field %q>", selector)
-}
+		if group.pending {
+			// Each Docker log is a whole line
+			group.restOfLine = false
+			if group.add([]byte(log)) {
+				return nil
+			}
+		}
+		if err := echo.write([]byte(dockerTextLine(log, fields))); err != nil {
+			return err
+		}
+		return echo.end()
+	}
 
-func isList(jsons io.Reader) (io.Reader, bool) {
-	buf := make([]byte, 1)
+	if j.tmpl == nil {
+		names := make([]string, len(j.fieldSelectors))
+		for i, sel := range j.fieldSelectors {
+			names[i] = sel.String()
+		}
+		if err := enc.header(names); err != nil {
+			return err
+		}
+	}
 
-	// WHY: was unable to find something like peek on json Decoder
 	for {
-		n, err := jsons.Read(buf)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tok, err := scan.next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			// FIXME: Probably would be better to fail here with a more clear error =P
-			return jsons, false
-		}
-		if n == 0 {
-			// From the docs:
-			//
-			// https://golang.org/pkg/io/#Reader
-			//
-			// Implementations of Read are discouraged from
-			// returning a zero byte count with a nil error,
-			// except when len(p) == 0. Callers should treat a
-			// return of 0 and nil as indicating that nothing happened;
-			// in particular it does not indicate EOF.
-			//
-			// Hope it doesn't result in some infinite loop =/
-			continue
+			return err
 		}
 
-		firstToken := buf[0]
-		if isSpace(firstToken) {
+		m := map[string]interface{}{}
+		if tok.kind == textToken || decodeObject(tok.data, &m) != nil {
+			if err := echo.write(tok.data); err != nil {
+				return err
+			}
 			continue
 		}
 
-		isList := firstToken == '['
-		return io.MultiReader(bytes.NewBuffer([]byte{firstToken}), jsons), isList
+		if fields, ok := j.linePrefix(echo.line()); ok {
+			echo.cutLine()
+			setFields(m, fields)
+		}
+		if err := echo.end(); err != nil {
+			return err
+		}
+		if err := transformObject(m); err != nil {
+			return err
+		}
 	}
-}
 
-func isSpace(c byte) bool {
-	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+	if err := echo.end(); err != nil {
+		return err
+	}
+	if err := endGroup(); err != nil {
+		return err
+	}
+	return enc.flush()
 }
 
-func (e Err) Error() string {
-	return string(e)
+// decodeObject decodes a JSON object keeping numbers as json.Number,
+// so they are rendered exactly as they are on the input, since
+// decoding them as float64 would lose precision (like on big IDs).
+func decodeObject(data []byte, obj *map[string]interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(obj)
 }
 
-func trimSpaces(s []string) []string {
-	trimmed := make([]string, len(s))
-	for i, v := range s {
-		trimmed[i] = strings.TrimSpace(v)
+func (j J) with(opts []Option) J {
+	for _, opt := range opts {
+		opt(&j)
 	}
-	return trimmed
+	return j
 }
 
-// bufferedReader is not exactly like the bufio on stdlib.
-// The idea is to use it as a means to buffer read data
-// until reset is called. We need this so when
-// the JSON decoder finds an error in the stream we can retrieve
-// exactly how much has been read between the last successful
-// decode and the current error and echo it.
-//
-// To guarantee that we provide data byte per byte, which is
-// not terribly efficient but was the only way so far to be sure
-// (assuming that the json decoder does no lookahead) that when
-// an error occurs on the json decoder we have the exact byte stream that
-// caused the error (I would welcome with open arms a better solution x_x).
-type bufferedReader struct {
-	r       io.Reader
-	buffer  []byte
-	readErr error
+// project selects the fields of the object, using the template
+// if there is one (rendered as a single field) or else the field selectors.
+func (j J) project(obj map[string]interface{}, stats *Stats) []field {
+	if j.tmpl != nil {
+		f := field{value: j.execTemplate(obj), ok: true}
+		if j.color {
+			f.color = j.severityColor(obj)
+		}
+		return []field{f}
+	}
+	fields := make([]field, len(j.fieldSelectors))
+	for i, fieldSelector := range j.fieldSelectors {
+		v, ok := selectValue(fieldSelector, obj)
+		f := field{name: fieldSelector.String(), raw: v, ok: ok}
+		if ok {
+			f.value = escapeNewlines(renderValue(v, j.flatten))
+		} else {
+			f.value = missingFieldErrMsg(f.name)
+			stats.MissingFields++
+		}
+		fields[i] = f
+	}
+	if j.color {
+		j.colorFields(obj, fields)
+	}
+	return fields
 }
 
-func (b *bufferedReader) Read(data []byte) (int, error) {
-	if len(data) == 0 {
-		return 0, nil
+// selectField selects the field and renders it as text. If the field
+// is missing it renders an error message and returns false.
+func selectField(selector Selector, obj map[string]interface{}, flatten bool) (string, bool) {
+	v, ok := selectValue(selector, obj)
+	if !ok {
+		return missingFieldErrMsg(selector.String()), false
 	}
+	return escapeNewlines(renderValue(v, flatten)), true
+}
 
-	data = data[:1]
-	n, err := b.r.Read(data)
-
-	b.readErr = err
-
-	if n > 0 {
-		b.buffer = append(b.buffer, data[0])
+// selectValue selects the field applying the selector number format.
+func selectValue(selector Selector, obj map[string]interface{}) (interface{}, bool) {
+	v, ok := selector.Select(obj)
+	if !ok || selector.format == "" {
+		return v, ok
 	}
-
-	return n, err
+	if formatted, ok := formatNumber(v, selector.format); ok {
+		return formattedNumber(formatted), true
+	}
+	return v, true
 }
 
-func (b *bufferedReader) hasData() bool {
-	return b.readErr == nil
+func escapeNewlines(s string) string {
+	return strings.Replace(s, "\n", "\\n", -1)
 }
 
-func (b *bufferedReader) readBuffer() []byte {
-	return b.buffer
+func missingFieldErrMsg(selector string) string {
+	return fmt.Sprintf("<jtoh:missing field %q>", selector)
 }
 
-func (b *bufferedReader) reset() {
-	b.buffer = make([]byte, 0, 1024)
+func (e Err) Error() string {
+	return string(e)
 }
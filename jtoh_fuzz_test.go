@@ -109,17 +109,6 @@ func FuzzJTOHValid(f *testing.F) {
 	}
 
 	f.Fuzz(func(t *testing.T, key string, val string) {
-		// Since field selectors have spaces trimmed for now we also
-		// trim the key, or else we would not be able to select the key.
-		key = strings.TrimSpace(key)
-		if key == "" {
-			return
-		}
-		if strings.ContainsAny(key, ".:") {
-			// We don't handle nesting/keys with dot on name for now.
-			return
-		}
-
 		input, err := json.Marshal(map[string]string{key: val})
 		if err != nil {
 			return
@@ -139,7 +128,10 @@ func FuzzJTOHValid(f *testing.F) {
 			wantValue = v
 		}
 
-		selector := ":" + selectKey
+		// Quoting the key makes any key selectable, even the ones with
+		// characters that are part of the selector syntax.
+		quoter := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		selector := `:"` + quoter.Replace(selectKey) + `"`
 
 		j, err := jtoh.New(selector)
 		if err != nil {
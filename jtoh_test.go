@@ -3,11 +3,13 @@ package jtoh_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/madlambda/jtoh"
 )
@@ -44,6 +46,56 @@ func TestTransform(t *testing.T) {
 			selector: "λ",
 			wantErr:  jtoh.InvalidSelectorErr,
 		},
+		{
+			name:     "ErrOnUnclosedIndex",
+			selector: ":list[0",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnInvalidIndex",
+			selector: ":list[first]",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnInvalidSlice",
+			selector: ":list[1:2:3]",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnKeyRightAfterIndex",
+			selector: ":list[0]field",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnRecursiveDescentWithoutKey",
+			selector: ":nested..",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnRecursiveDescentFollowedByDot",
+			selector: ":...field",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnUnclosedQuote",
+			selector: `:"field`,
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnDanglingEscape",
+			selector: `:field\`,
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnEmptyFallback",
+			selector: ":message|",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
+		{
+			name:     "ErrOnEmptyFallbackBeforeDefault",
+			selector: ":message|?=none",
+			wantErr:  jtoh.InvalidSelectorErr,
+		},
 		{
 			name:     "EmptyInput",
 			selector: ":field",
@@ -129,13 +181,60 @@ func TestTransform(t *testing.T) {
 			output:   []string{fmt.Sprintf("hi:7:%s:false", missingFieldErrMsg("missing"))},
 		},
 		{
-			// There is no way to project a key that has . inside.
-			// This is not a desirable limitation, but we have it for now.
+			// Keys that have . inside must be quoted or escaped.
 			name:     "NestedAccessWontMatchSingleFieldWithDot",
 			selector: ":nested.val",
 			input:    []string{`{"nested.val" : "value" }`},
 			output:   []string{missingFieldErrMsg("nested.val")},
 		},
+		{
+			name:     "QuotedKeyWithDot",
+			selector: `:"nested.val":labels."app.kubernetes.io/name"`,
+			input:    []string{`{"nested.val":"value","labels":{"app.kubernetes.io/name":"app"}}`},
+			output:   []string{"value:app"},
+		},
+		{
+			name:     "EscapedKeyWithDot",
+			selector: `:nested\.val:labels.app\.kubernetes\.io/name`,
+			input:    []string{`{"nested.val":"value","labels":{"app.kubernetes.io/name":"app"}}`},
+			output:   []string{"value:app"},
+		},
+		{
+			name:     "QuotedKeyWithSeparator",
+			selector: `:"a:b":c\:d`,
+			input:    []string{`{"a:b":"quoted","c:d":"escaped"}`},
+			output:   []string{"quoted:escaped"},
+		},
+		{
+			name:     "QuotedKeyWithEscapes",
+			selector: `:"say \"hi\"":"back\\slash"`,
+			input:    []string{`{"say \"hi\"":"quote","back\\slash":"slash"}`},
+			output:   []string{"quote:slash"},
+		},
+		{
+			name:     "QuotedKeyWithSpecialChars",
+			selector: `:"*":"list[0]":".."`,
+			input:    []string{`{"*":"star","list[0]":"brackets","..":"dots","list":[0]}`},
+			output:   []string{"star:brackets:dots"},
+		},
+		{
+			name:     "QuotedKeyPreservesSpaces",
+			selector: `: " spaced " `,
+			input:    []string{`{" spaced ":"value","spaced":"wrong"}`},
+			output:   []string{"value"},
+		},
+		{
+			name:     "QuotedEmptyKey",
+			selector: `:"".field`,
+			input:    []string{`{"":{"field":"value"}}`},
+			output:   []string{"value"},
+		},
+		{
+			name:     "PartiallyQuotedKey",
+			selector: `:logging."googleapis.com"/trace`,
+			input:    []string{`{"logging":{"googleapis.com/trace":"trace"}}`},
+			output:   []string{"trace"},
+		},
 		{
 			name:     "IncompletePathToField",
 			selector: ":nested.number",
@@ -148,6 +247,323 @@ func TestTransform(t *testing.T) {
 			input:    []string{`{"nested" : "notObj" }`},
 			output:   []string{missingFieldErrMsg("nested.number")},
 		},
+		{
+			name:     "SelectArrayIndex",
+			selector: ":list[1]",
+			input:    []string{`{"list":["a","b","c"]}`},
+			output:   []string{"b"},
+		},
+		{
+			name:     "SelectArrayNegativeIndex",
+			selector: ":list[-1]",
+			input:    []string{`{"list":["a","b","c"]}`},
+			output:   []string{"c"},
+		},
+		{
+			name:     "SelectNestedFieldFromArrayIndex",
+			selector: ":spans[0].name:spans[1].name",
+			input:    []string{`{"spans":[{"name":"first"},{"name":"second"}]}`},
+			output:   []string{"first:second"},
+		},
+		{
+			name:     "SelectNestedArrayIndexes",
+			selector: ":matrix[1][0]",
+			input:    []string{`{"matrix":[[1,2],[3,4]]}`},
+			output:   []string{"3"},
+		},
+		{
+			name:     "SelectArraySlice",
+			selector: ":list[1:3]",
+			input:    []string{`{"list":["a","b","c","d"]}`},
+			output:   []string{`["b","c"]`},
+		},
+		{
+			name:     "SelectArraySliceWithOpenBounds",
+			selector: ":list[:2]:list[-2:]",
+			input:    []string{`{"list":["a","b","c","d"]}`},
+			output:   []string{`["a","b"]:["c","d"]`},
+		},
+		{
+			name:     "SelectNestedFieldFromArraySlice",
+			selector: ":items[1:3].id",
+			input:    []string{`{"items":[{"id":1},{"id":2},{"id":3}]}`},
+			output:   []string{"[2,3]"},
+		},
+		{
+			name:     "SelectArraySliceWithSingleElement",
+			selector: ":list[0:1]",
+			input:    []string{`{"list":["a","b"]}`},
+			output:   []string{`["a"]`},
+		},
+		{
+			name:     "ArrayIndexOutOfRange",
+			selector: ":list[3]:list[-4]",
+			input:    []string{`{"list":["a","b","c"]}`},
+			output: []string{
+				missingFieldErrMsg("list[3]") + ":" + missingFieldErrMsg("list[-4]"),
+			},
+		},
+		{
+			name:     "ArraySliceOutOfRange",
+			selector: ":list[5:]",
+			input:    []string{`{"list":["a","b","c"]}`},
+			output:   []string{missingFieldErrMsg("list[5:]")},
+		},
+		{
+			name:     "ArrayIndexOnNonArray",
+			selector: ":field[0]",
+			input:    []string{`{"field":"value"}`},
+			output:   []string{missingFieldErrMsg("field[0]")},
+		},
+		{
+			name:     "SelectWildcard",
+			selector: ":labels.*",
+			input:    []string{`{"labels":{"b":"second","a":"first"}}`},
+			output:   []string{`["first","second"]`},
+		},
+		{
+			name:     "SelectWildcardOnArray",
+			selector: ":spans.*.name",
+			input:    []string{`{"spans":[{"name":"first"},{"name":"second"}]}`},
+			output:   []string{`["first","second"]`},
+		},
+		{
+			name:     "SelectWildcardSkipsMissingFields",
+			selector: ":*.name",
+			input:    []string{`{"a":{"name":"first"},"b":{"id":1},"c":{"name":"third"}}`},
+			output:   []string{`["first","third"]`},
+		},
+		{
+			name:     "SelectWildcardWithNoMatch",
+			selector: ":labels.*",
+			input:    []string{`{"labels":{}}`},
+			output:   []string{missingFieldErrMsg("labels.*")},
+		},
+		{
+			name:     "SelectRecursiveDescent",
+			selector: ":..error",
+			input: []string{
+				`{"error":"top"}`,
+				`{"nested":{"error":"nested"}}`,
+				`{"list":[{"deep":{"error":"deep"}}]}`,
+			},
+			output: []string{"top", "nested", "deep"},
+		},
+		{
+			name:     "SelectRecursiveDescentPicksShallowestMatch",
+			selector: ":..error",
+			input:    []string{`{"a":{"b":{"error":"deep"}},"z":{"error":"shallow"}}`},
+			output:   []string{"shallow"},
+		},
+		{
+			name:     "SelectRecursiveDescentFromNestedField",
+			selector: ":resource..name",
+			input:    []string{`{"name":"root","resource":{"labels":{"name":"label"}}}`},
+			output:   []string{"label"},
+		},
+		{
+			name:     "SelectRecursiveDescentWithNestedAccess",
+			selector: ":..error.code",
+			input:    []string{`{"response":{"error":{"code":500}}}`},
+			output:   []string{"500"},
+		},
+		{
+			name:     "SelectRecursiveDescentWithWildcard",
+			selector: ":labels..*",
+			input:    []string{`{"labels":{"a":1,"b":{"c":2}}}`},
+			output:   []string{`[1,{"c":2},2]`},
+		},
+		{
+			name:     "SelectEmbeddedJSON",
+			selector: ":textPayload->msg:log->user.name",
+			input: []string{
+				`{"textPayload":"{\"msg\":\"embedded\"}","log":"{\"user\":{\"name\":\"ed\"}}"}`,
+			},
+			output: []string{"embedded:ed"},
+		},
+		{
+			name:     "SelectEmbeddedJSONDocument",
+			selector: ":payload->:payload->[1]:payload->[0].n%.1f",
+			input:    []string{`{"payload":"[{\"n\":1.25}, 2]"}`},
+			output:   []string{`[{"n":1.25},2]:2:1.2`},
+		},
+		{
+			name:     "SelectEmbeddedJSONNested",
+			selector: ":a->b->c",
+			input:    []string{`{"a":"{\"b\":\"{\\\"c\\\":\\\"deep\\\"}\"}"}`},
+			output:   []string{"deep"},
+		},
+		{
+			name:     "SelectEmbeddedJSONAlreadyDecoded",
+			selector: ":payload->msg",
+			input:    []string{`{"payload":{"msg":"object"}}`},
+			output:   []string{"object"},
+		},
+		{
+			name:     "SelectEmbeddedJSONWithDescentAndWildcard",
+			selector: ":log->..id:log->*",
+			input:    []string{`{"log":"{\"a\":{\"id\":1},\"b\":2}"}`},
+			output:   []string{`1:[{"id":1},2]`},
+		},
+		{
+			name:     "SelectEmbeddedJSONNotValid",
+			selector: ":log->msg|log?=none:n->",
+			input:    []string{`{"log":"{\"msg\": unfinished","n":1}`},
+			output:   []string{`{"msg": unfinished:` + missingFieldErrMsg("n->")},
+		},
+		{
+			name:     "SelectKeyWithEscapedArrow",
+			selector: `:a\->b:"c->d"`,
+			input:    []string{`{"a->b":1,"c->d":2}`},
+			output:   []string{"1:2"},
+		},
+		{
+			name:     "SelectRecursiveDescentWithNoMatch",
+			selector: ":..error",
+			input:    []string{`{"nested":{"msg":"ok"}}`},
+			output:   []string{missingFieldErrMsg("..error")},
+		},
+		{
+			name:     "SelectObjectRendersCompactJSON",
+			selector: ":labels:error.details",
+			input: []string{
+				`{"labels":{"b":2,"a":"x"},"error":{"details":[{"code":1}, {"tags":[]}]}}`,
+			},
+			output: []string{`{"a":"x","b":2}:[{"code":1},{"tags":[]}]`},
+		},
+		{
+			name:     "SelectObjectDoesNotEscapeHTML",
+			selector: ":obj",
+			input:    []string{`{"obj":{"html":"<a href='x'>&</a>"}}`},
+			output:   []string{`{"html":"<a href='x'>&</a>"}`},
+		},
+		{
+			name:     "SelectObjectKeepsNewlinesEscaped",
+			selector: ":obj",
+			input:    []string{`{"obj":{"msg":"a\nb"}}`},
+			output:   []string{`{"msg":"a\nb"}`},
+		},
+		{
+			name:     "SelectEmptyObjectAndArray",
+			selector: ":obj:list",
+			input:    []string{`{"obj":{},"list":[]}`},
+			output:   []string{`{}:[]`},
+		},
+		{
+			name:     "NumbersAreRenderedExactly",
+			selector: ":trace:ts:latency:exp",
+			input:    []string{`{"trace":1594600000000000123,"ts":1594600000123456789,"latency":1.50,"exp":1e3}`},
+			output:   []string{"1594600000000000123:1594600000123456789:1.50:1e3"},
+		},
+		{
+			name:     "NumbersInsideObjectsAreRenderedExactly",
+			selector: ":span",
+			input:    []string{`{"span":{"id":1594600000000000123,"ratio":0.10}}`},
+			output:   []string{`{"id":1594600000000000123,"ratio":0.10}`},
+		},
+		{
+			name:     "FormatNumbers",
+			selector: ":latency%.2f:status%5d:id%x:big%d:exp%d:ratio%e",
+			input:    []string{`{"latency":1.23456,"status":200,"id":255,"big":1594600000000000123,"exp":1.5e3,"ratio":0.5}`},
+			output:   []string{"1.23:  200:ff:1594600000000000123:1500:5.000000e-01"},
+		},
+		{
+			name:     "FormatIntegerVerbTruncatesFractions",
+			selector: ":latency%d",
+			input:    []string{`{"latency":3.99}`},
+			output:   []string{"3"},
+		},
+		{
+			name:     "FormatNumericStrings",
+			selector: ":latency%.1f",
+			input:    []string{`{"latency":"0.25"}`},
+			output:   []string{"0.2"},
+		},
+		{
+			name:     "FormatIgnoresNonNumbers",
+			selector: ":latency%.1f:obj%d",
+			input:    []string{`{"latency":"slow","obj":{"a":1}}`},
+			output:   []string{`slow:{"a":1}`},
+		},
+		{
+			name:     "FormatWithFallbacksAndDefault",
+			selector: ":latency|duration%.1f?=unknown",
+			input: []string{
+				`{"duration":1.25}`,
+				`{}`,
+			},
+			output: []string{"1.2", "unknown"},
+		},
+		{
+			name:     "PercentOnKeysThatAreNotFormats",
+			selector: `:cpu%:a%b.c:a\%d`,
+			input:    []string{`{"cpu%":50,"a%b":{"c":1},"a%d":2}`},
+			output:   []string{"50:1:2"},
+		},
+		{
+			name:     "SelectFirstFallbackPresent",
+			selector: ":message|msg|textPayload",
+			input: []string{
+				`{"message":"first","msg":"second","textPayload":"third"}`,
+				`{"msg":"second","textPayload":"third"}`,
+				`{"textPayload":"third"}`,
+			},
+			output: []string{"first", "second", "third"},
+		},
+		{
+			name:     "SelectFallbackWithNestedPaths",
+			selector: ":error.message|err.msg",
+			input:    []string{`{"err":{"msg":"failed"}}`},
+			output:   []string{"failed"},
+		},
+		{
+			name:     "FallbacksWithNoMatch",
+			selector: ":message|msg",
+			input:    []string{`{"textPayload":"third"}`},
+			output:   []string{missingFieldErrMsg("message|msg")},
+		},
+		{
+			name:     "SelectDefaultValue",
+			selector: ":user.id?=anonymous:msg",
+			input: []string{
+				`{"user":{"id":"katz"},"msg":"hi"}`,
+				`{"msg":"hi"}`,
+			},
+			output: []string{"katz:hi", "anonymous:hi"},
+		},
+		{
+			name:     "SelectDefaultValueAfterFallbacks",
+			selector: ":message|msg?=no message",
+			input: []string{
+				`{"msg":"hi"}`,
+				`{"text":"hi"}`,
+			},
+			output: []string{"hi", "no message"},
+		},
+		{
+			name:     "SelectEmptyDefaultValue",
+			selector: ":user?=:msg",
+			input:    []string{`{"msg":"hi"}`},
+			output:   []string{":hi"},
+		},
+		{
+			name:     "SelectDefaultValueWithEscapedSeparator",
+			selector: `:time?=00\:00:msg`,
+			input:    []string{`{"msg":"hi"}`},
+			output:   []string{"00:00:hi"},
+		},
+		{
+			name:     "QuestionMarkIsPartOfKey",
+			selector: ":what?:really?.sure",
+			input:    []string{`{"what?":"yes","really?":{"sure":"no"}}`},
+			output:   []string{"yes:no"},
+		},
+		{
+			name:     "QuotedKeyWithFallbackAndDefaultChars",
+			selector: `:"a|b":"c?=d"`,
+			input:    []string{`{"a|b":"pipe","c?=d":"default"}`},
+			output:   []string{"pipe:default"},
+		},
 		{
 			name:     "UnselectedFieldIsIgnored",
 			selector: ":number",
@@ -332,6 +748,88 @@ func TestTransform(t *testing.T) {
 				"whatever,hi},hello",
 			},
 		},
+		{
+			name:     "PrettyPrintedObjs",
+			selector: ":nested.field:list[1]",
+			input: []string{
+				"{\n  \"nested\": {\n    \"field\": \"pretty\"\n  },\n  \"list\": [\n    1,\n    2\n  ]\n}",
+				"{\"nested\":{\"field\":\"compact\"},\"list\":[3,4]}",
+			},
+			output: []string{"pretty:2", "compact:4"},
+		},
+		{
+			name:     "StringsWithJSONSyntax",
+			selector: ":field",
+			input: []string{
+				`{"field":"{\"not\":[\"an obj\"]}"}`,
+				`{"field":"\\"}`,
+			},
+			output: []string{`{"not":["an obj"]}`, `\`},
+		},
+		{
+			name:     "StringsWithUnicodeEscapes",
+			selector: ":field",
+			input:    []string{`{"field":"\u00e9\u4e16"}`},
+			output:   []string{"é世"},
+		},
+		{
+			name:     "InvalidObjIsEchoed",
+			selector: ":field",
+			input: []string{
+				`{"field":"stonks"}`,
+				`{"field": nope}`,
+				`{"field":"stonks2"}`,
+			},
+			streamOutput: []string{
+				"stonks",
+				"",
+				`{"field": nope}`,
+				"stonks2",
+			},
+			listOutput: []string{
+				"stonks",
+				`,{"field": nope},`,
+				"stonks2",
+			},
+		},
+		{
+			name:     "UnfinishedObjIsEchoed",
+			selector: ":field",
+			input: []string{
+				`{"field":"stonks"}`,
+				`{"field":"unfinished"`,
+			},
+			streamOutput: []string{
+				"stonks",
+				"",
+				`{"field":"unfinished"`,
+			},
+			listOutput: []string{
+				"stonks",
+				`,{"field":"unfinished"]`,
+			},
+		},
+		{
+			name:     "EchoesScalars",
+			selector: ":field",
+			input: []string{
+				`{"field":"test"}`,
+				`"string"`,
+				`-6.6e10`,
+				`true`,
+			},
+			streamOutput: []string{
+				"test",
+				"",
+				`"string"`,
+				`-6.6e10`,
+				`true`,
+			},
+			listOutput: []string{
+				"test",
+				`,"string",-6.6e10,true`,
+			},
+		},
 		{
 			name:     "EchoesLists",
 			selector: ":field",
@@ -355,7 +853,7 @@ func TestTransform(t *testing.T) {
 		test := tests[i]
 
 		t.Run(test.name+"ParsingList", func(t *testing.T) {
-			input := strings.NewReader("[" + strings.Join(test.input, ",") + "]")
+			input := "[" + strings.Join(test.input, ",") + "]"
 			wantOutput := test.output
 			if len(test.listOutput) > 0 {
 				wantOutput = test.listOutput
@@ -364,7 +862,7 @@ func TestTransform(t *testing.T) {
 		})
 
 		t.Run(test.name+"ParsingStream", func(t *testing.T) {
-			input := strings.NewReader(strings.Join(test.input, "\n"))
+			input := strings.Join(test.input, "\n")
 			wantOutput := test.output
 			if len(test.streamOutput) > 0 {
 				wantOutput = test.streamOutput
@@ -374,16 +872,209 @@ func TestTransform(t *testing.T) {
 	}
 }
 
+func TestTransformBigObjs(t *testing.T) {
+	// Objs bigger than the blocks read from the input
+	bigValue := strings.Repeat("big", 100000)
+
+	j, err := jtoh.New(":field:n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		fmt.Sprintf(`{"field":"%s","n":1}`, bigValue),
+		`not JSON`,
+		fmt.Sprintf(`{"field":"%s","n":2}`, bigValue),
+	}, "\n")
+	output := bytes.Buffer{}
+
+	if err := j.DoContext(context.Background(), strings.NewReader(input), &output); err != nil {
+		t.Fatalf("unexpected error [%v]", err)
+	}
+
+	want := bigValue + ":1\n\nnot JSON\n" + bigValue + ":2\n"
+	if got := output.String(); got != want {
+		t.Errorf("got %d bytes of output, want %d", len(got), len(want))
+	}
+}
+
+func TestTransformDeeplyNestedObjs(t *testing.T) {
+	j, err := jtoh.New(":field")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooDeep := strings.Repeat("[", 20000) + strings.Repeat("]", 20000)
+	input := `{"field":"first"}` + "\n" +
+		`{"nested":` + tooDeep + `}` + "\n" +
+		`{"field":"last"}`
+	output := bytes.Buffer{}
+
+	if err := j.DoContext(context.Background(), strings.NewReader(input), &output); err != nil {
+		t.Fatalf("unexpected error [%v]", err)
+	}
+
+	lines := strings.Split(output.String(), "\n")
+	if len(lines) != 5 || lines[0] != "first" || lines[3] != "last" {
+		t.Errorf("unexpected output lines: %d", len(lines))
+	}
+}
+
+func TestDoContextReturnsReadErrors(t *testing.T) {
+	j, err := jtoh.New(":field")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantErr := errors.New("read error")
+	input := io.MultiReader(
+		strings.NewReader(`{"field":"first"}`),
+		iotest.ErrReader(wantErr),
+	)
+	output := bytes.Buffer{}
+
+	err = j.DoContext(context.Background(), input, &output)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("got err[%v] want[%v]", err, wantErr)
+	}
+	if got, want := output.String(), "first\n"; got != want {
+		t.Errorf("got output %q want %q", got, want)
+	}
+}
+
+func TestDoContextReturnsReadErrorsOnFirstRead(t *testing.T) {
+	j, err := jtoh.New(":field")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantErr := errors.New("read error")
+	err = j.DoContext(context.Background(), iotest.ErrReader(wantErr), io.Discard)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("got err[%v] want[%v]", err, wantErr)
+	}
+}
+
+func TestDoContextReturnsWriteErrors(t *testing.T) {
+	j, err := jtoh.New(":field")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := []string{
+		`{"field":"value"}`,
+		`not JSON`,
+	}
+
+	for _, input := range inputs {
+		wantErr := errors.New("write error")
+		err = j.DoContext(context.Background(), strings.NewReader(input), errWriter{wantErr})
+		if !errors.Is(err, wantErr) {
+			t.Errorf("input %q: got err[%v] want[%v]", input, err, wantErr)
+		}
+	}
+}
+
+func TestDoContextStopsWhenCancelled(t *testing.T) {
+	j, err := jtoh.New(":field")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	input := &cancelReader{
+		r:      strings.NewReader(`{"field":"first"} {"field":"second"}`),
+		cancel: cancel,
+		after:  len(`{"field":"first"}`),
+	}
+	output := bytes.Buffer{}
+
+	err = j.DoContext(ctx, input, &output)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got err[%v] want[%v]", err, context.Canceled)
+	}
+	if got, want := output.String(), "first\n"; got != want {
+		t.Errorf("got output %q want %q", got, want)
+	}
+}
+
+func TestStats(t *testing.T) {
+	filter, err := jtoh.ParseFilter("field")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats jtoh.Stats
+	j, err := jtoh.New(":field:missing", jtoh.WithFilter(filter), jtoh.WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`{"field":"first"}`,
+		`not JSON`,
+		`{"other":"filtered"}`,
+		`{"field":"second","missing":"found"}`,
+		`not JSON again`,
+	}, "\n")
+
+	if err := j.DoContext(context.Background(), strings.NewReader(input), io.Discard); err != nil {
+		t.Fatalf("unexpected error [%v]", err)
+	}
+
+	want := jtoh.Stats{
+		Records:       3,
+		Filtered:      1,
+		NonJSON:       2,
+		MissingFields: 1,
+	}
+	if stats != want {
+		t.Errorf("got stats %+v want %+v", stats, want)
+	}
+}
+
+func TestWithField(t *testing.T) {
+	filter, err := jtoh.ParseFilter(`_file == "app.log"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jtoh.New(":_file:msg",
+		jtoh.WithField("_file", "other.log"),
+		jtoh.WithField("_file", "app.log"),
+		jtoh.WithFilter(filter),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`{"msg":"first"}`,
+		`{"msg":"replaced","_file":"input"}`,
+	}, "\n")
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(input), output)
+
+	want := "app.log:first\napp.log:replaced\n"
+	if output.String() != want {
+		t.Errorf("got %q want %q", output.String(), want)
+	}
+}
+
+// testTransform transforms the input with the given selector and
+// options, checking the output lines. The input is transformed
+// twice, the second time being read one byte at a time.
 func testTransform(
 	t *testing.T,
-	input io.Reader,
+	input string,
 	selector string,
 	want []string,
 	wantErr error,
+	opts ...jtoh.Option,
 ) {
 	t.Helper()
 
-	j, err := jtoh.New(selector)
+	j, err := jtoh.New(selector, opts...)
 
 	if wantErr != nil {
 		if !errors.Is(err, wantErr) {
@@ -397,35 +1088,69 @@ func testTransform(
 		return
 	}
 
-	output := bytes.Buffer{}
+	for _, oneByte := range []bool{false, true} {
+		var reader io.Reader = strings.NewReader(input)
+		msg := ""
+		if oneByte {
+			reader = iotest.OneByteReader(reader)
+			msg = "reading one byte at a time: "
+		}
 
-	j.Do(input, &output)
+		output := bytes.Buffer{}
 
-	gotLines := bufio.NewScanner(&output)
-	lineCount := 0
+		j.Do(reader, &output)
 
-	for gotLines.Scan() {
-		gotLine := gotLines.Text()
-		if lineCount >= len(want) {
-			t.Errorf("unexpected extra line: %q", gotLine)
-			continue
-		}
-		wantLine := want[lineCount]
-		if gotLine != wantLine {
-			t.Errorf("line[%d]: got %q != want %q", lineCount, gotLine, wantLine)
+		gotLines := bufio.NewScanner(&output)
+		lineCount := 0
+
+		for gotLines.Scan() {
+			gotLine := gotLines.Text()
+			if lineCount >= len(want) {
+				t.Errorf("%sunexpected extra line: %q", msg, gotLine)
+				continue
+			}
+			wantLine := want[lineCount]
+			if gotLine != wantLine {
+				t.Errorf("%sline[%d]: got %q != want %q", msg, lineCount, gotLine, wantLine)
+			}
+			lineCount++
 		}
-		lineCount++
-	}
 
-	if lineCount != len(want) {
-		t.Errorf("got %d lines, want %d", lineCount, len(want))
-	}
+		if lineCount != len(want) {
+			t.Errorf("%sgot %d lines, want %d", msg, lineCount, len(want))
+		}
 
-	if err := gotLines.Err(); err != nil {
-		t.Errorf("unexpected error scanning output lines: %v", err)
+		if err := gotLines.Err(); err != nil {
+			t.Errorf("%sunexpected error scanning output lines: %v", msg, err)
+		}
 	}
 }
 
 func missingFieldErrMsg(selector string) string {
 	return fmt.Sprintf("<jtoh:missing field %q>", selector)
 }
+
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+// cancelReader cancels a context after reading the given amount of bytes
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+	after  int
+	read   int
+}
+
+func (c *cancelReader) Read(data []byte) (int, error) {
+	n, err := c.r.Read(data)
+	c.read += n
+	if c.read >= c.after {
+		c.cancel()
+	}
+	return n, err
+}
@@ -0,0 +1,166 @@
+package jtoh
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// LogfmtMode is how lines that are not JSON are handled as logfmt,
+// like:
+//
+// level=info msg="server started" port=8080
+type LogfmtMode int
+
+const (
+	// LogfmtAuto handles as logfmt only lines where all tokens are
+	// key=value pairs, with at least two pairs, so plain text is
+	// very unlikely to be mistaken as logfmt.
+	LogfmtAuto LogfmtMode = iota
+	// LogfmtForce handles as logfmt all lines that are not JSON and
+	// can be parsed, keys without a value are set to true.
+	LogfmtForce
+	// LogfmtOff disables logfmt handling, lines that are not JSON
+	// are always echoed.
+	LogfmtOff
+)
+
+var logfmtModeNames = map[LogfmtMode]string{
+	LogfmtAuto:  "auto",
+	LogfmtForce: "force",
+	LogfmtOff:   "off",
+}
+
+// minLogfmtPairs is how many key=value pairs a line
+// must have to be detected as logfmt.
+const minLogfmtPairs = 2
+
+// ParseLogfmtMode parses the name of a logfmt mode, like "auto".
+func ParseLogfmtMode(name string) (LogfmtMode, error) {
+	for m, n := range logfmtModeNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("%w:%s", InvalidLogfmtModeErr, name)
+}
+
+// String returns the name of the mode.
+func (m LogfmtMode) String() string {
+	if name, ok := logfmtModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogfmtMode(%d)", int(m))
+}
+
+// WithLogfmt configures how lines that are not JSON are handled as
+// logfmt. Lines handled as logfmt are transformed just like JSON
+// objects, with unquoted numbers and booleans decoded as such and
+// everything else as strings. The default is LogfmtAuto.
+func WithLogfmt(mode LogfmtMode) Option {
+	return func(j *J) {
+		j.logfmt = mode
+	}
+}
+
+// parseLogfmt parses a line as logfmt, returning false if the line
+// is not logfmt according to the mode.
+func parseLogfmt(line []byte, mode LogfmtMode) (map[string]interface{}, bool) {
+	if mode == LogfmtOff {
+		return nil, false
+	}
+
+	obj := map[string]interface{}{}
+	pairs := 0
+	pos := 0
+
+	for {
+		for pos < len(line) && isSpace(line[pos]) {
+			pos++
+		}
+		if pos == len(line) {
+			break
+		}
+
+		start := pos
+		for pos < len(line) && isLogfmtKeyByte(line[pos]) {
+			pos++
+		}
+		key := string(line[start:pos])
+		if key == "" {
+			return nil, false
+		}
+
+		if pos == len(line) || isSpace(line[pos]) {
+			if mode != LogfmtForce {
+				return nil, false
+			}
+			obj[key] = true
+			continue
+		}
+		if line[pos] != '=' {
+			return nil, false
+		}
+		pos++
+
+		value, n, ok := logfmtValue(line[pos:])
+		if !ok {
+			return nil, false
+		}
+		pos += n
+		if pos < len(line) && !isSpace(line[pos]) {
+			return nil, false
+		}
+		obj[key] = value
+		pairs++
+	}
+
+	if mode == LogfmtAuto && pairs < minLogfmtPairs {
+		return nil, false
+	}
+	return obj, len(obj) > 0
+}
+
+// logfmtValue parses the value of a pair, returning how much of data
+// was used. Quoted values are always strings.
+func logfmtValue(data []byte) (interface{}, int, bool) {
+	if len(data) > 0 && data[0] == '"' {
+		end := 1
+		for end < len(data) && data[end] != '"' {
+			if data[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(data) {
+			return nil, 0, false
+		}
+		s, err := strconv.Unquote(string(data[:end+1]))
+		if err != nil {
+			return nil, 0, false
+		}
+		return s, end + 1, true
+	}
+
+	end := 0
+	for end < len(data) && !isSpace(data[end]) {
+		if data[end] == '"' || data[end] == '=' {
+			return nil, 0, false
+		}
+		end++
+	}
+	value := string(data[:end])
+	switch {
+	case value == "true":
+		return true, end, true
+	case value == "false":
+		return false, end, true
+	case isJSONNumber(value):
+		return json.Number(value), end, true
+	}
+	return value, end, true
+}
+
+func isLogfmtKeyByte(c byte) bool {
+	return c > ' ' && c != '=' && c != '"' && c != 0x7f
+}
@@ -0,0 +1,183 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestLogfmt(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		mode     jtoh.LogfmtMode
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "Pairs",
+			selector: ":level:msg:port",
+			input:    []string{`level=info msg="server started" port=8080`},
+			want:     []string{"info:server started:8080"},
+		},
+		{
+			name:     "QuotedValuesWithEscapes",
+			selector: ":msg:err",
+			input:    []string{`msg="say \"hi\"" err="line1\nline2"`},
+			want:     []string{`say "hi":line1\nline2`},
+		},
+		{
+			name:     "EmptyValue",
+			selector: ":level:msg",
+			input:    []string{`level=info msg=`},
+			want:     []string{"info:"},
+		},
+		{
+			name:     "KeysWithDots",
+			selector: `:level:"http.status"`,
+			input:    []string{`level=warn http.status=503`},
+			want:     []string{"warn:503"},
+		},
+		{
+			name:     "MixedWithJSON",
+			selector: ":level:msg",
+			input: []string{
+				`{"level":"info","msg":"json"}`,
+				`level=info msg=logfmt`,
+				`not logfmt`,
+				``,
+				`level=debug msg="logfmt again"`,
+				`{"level":"warn","msg":"json again"}`,
+			},
+			want: []string{
+				"info:json",
+				"info:logfmt",
+				"not logfmt",
+				"debug:logfmt again",
+				"warn:json again",
+			},
+		},
+		{
+			name:     "BlankLinesBetweenLogfmtLines",
+			selector: ":level",
+			input:    []string{"level=info a=1", "", "  ", "level=warn a=2"},
+			want:     []string{"info", "warn"},
+		},
+		{
+			name:     "AutoRequiresTwoPairs",
+			selector: ":level",
+			input:    []string{`level=info`, `PATH=/usr/bin`},
+			want:     []string{"level=info", "PATH=/usr/bin"},
+		},
+		{
+			name:     "AutoRequiresOnlyPairs",
+			selector: ":level",
+			input: []string{
+				`level=info msg=started extra`,
+				`the result: a=1 b=2`,
+				`level=info msg="unclosed`,
+				`level=info msg=a"b`,
+			},
+			want: []string{
+				`level=info msg=started extra`,
+				`the result: a=1 b=2`,
+				`level=info msg="unclosed`,
+				`level=info msg=a"b`,
+			},
+		},
+		{
+			name:     "ForceAcceptsBareKeysAndSinglePairs",
+			selector: ":level:debug",
+			mode:     jtoh.LogfmtForce,
+			input:    []string{`level=info debug`, `level=warn`, `level=info msg="unclosed`},
+			want: []string{
+				"info:true",
+				`warn:<jtoh:missing field "debug">`,
+				`level=info msg="unclosed`,
+			},
+		},
+		{
+			name:     "Off",
+			selector: ":level",
+			mode:     jtoh.LogfmtOff,
+			input:    []string{`level=info msg=started`},
+			want:     []string{`level=info msg=started`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := strings.Join(test.input, "\n")
+			testTransform(t, input, test.selector, test.want, nil, jtoh.WithLogfmt(test.mode))
+		})
+	}
+}
+
+func TestLogfmtValuesCanBeFiltered(t *testing.T) {
+	filter, err := jtoh.ParseFilter(`status >= 500 && ok == false && msg == "failed"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jtoh.New(":status", jtoh.WithFilter(filter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`status=200 ok=true msg=done`,
+		`status=503 ok=false msg=failed`,
+		`status=504 ok=false msg="failed"`,
+		`status=505 ok="false" msg=failed`,
+	}, "\n")
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(input), output)
+
+	want := "503\n504\n"
+	if output.String() != want {
+		t.Errorf("got %q; want %q", output.String(), want)
+	}
+}
+
+func TestLogfmtStats(t *testing.T) {
+	var stats jtoh.Stats
+	j, err := jtoh.New(":level", jtoh.WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`level=info msg=one`,
+		`plain text`,
+		`level=info msg=two`,
+		`{"level":"info"}`,
+	}, "\n")
+	j.Do(strings.NewReader(input), &bytes.Buffer{})
+
+	want := jtoh.Stats{Records: 3, NonJSON: 1}
+	if stats != want {
+		t.Errorf("got %+v; want %+v", stats, want)
+	}
+}
+
+func TestParseLogfmtMode(t *testing.T) {
+	for _, want := range []jtoh.LogfmtMode{jtoh.LogfmtAuto, jtoh.LogfmtForce, jtoh.LogfmtOff} {
+		got, err := jtoh.ParseLogfmtMode(want.String())
+		if err != nil {
+			t.Errorf("ParseLogfmtMode(%q): unexpected error [%v]", want, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseLogfmtMode(%q): got %v want %v", want, got, want)
+		}
+	}
+
+	if _, err := jtoh.ParseLogfmtMode("always"); !errors.Is(err, jtoh.InvalidLogfmtModeErr) {
+		t.Errorf("got err[%v] want[%v]", err, jtoh.InvalidLogfmtModeErr)
+	}
+}
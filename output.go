@@ -0,0 +1,516 @@
+package jtoh
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format is how the transformed JSON objects are written.
+type Format int
+
+const (
+	// TextFormat writes the selected fields joined by the separator.
+	TextFormat Format = iota
+	// CSVFormat writes the selected fields as CSV (RFC 4180), quoting
+	// fields that have commas, quotes or leading spaces.
+	CSVFormat
+	// TSVFormat writes the selected fields separated by tabs, quoting
+	// fields just like CSVFormat does.
+	TSVFormat
+	// TableFormat writes the selected fields as aligned columns, with
+	// a header. The columns widths are computed over a sliding window
+	// of records (check WithTableWindow), so the output still streams.
+	TableFormat
+	// JSONFormat writes each JSON object as a JSON object with only the
+	// selected fields (newline delimited JSON). Fields are nested just
+	// like on the input, like {"resource":{"labels":{"pod":"x"}}} for
+	// "resource.labels.pod", unless WithFlatten is used, in which case
+	// the selectors are used as keys, like {"resource.labels.pod":"x"}.
+	// Selectors that are not just a path of keys (like fallbacks or
+	// indexes) are always used as keys. Missing fields are omitted.
+	// Data that is not JSON is wrapped, each line is written as an
+	// object like {"_raw":"line"}.
+	JSONFormat
+	// LogfmtFormat writes the selected fields as logfmt key=value
+	// pairs, using the selectors paths (without quotes, number formats
+	// and default values) as keys. Values are quoted when needed and
+	// missing fields are omitted.
+	LogfmtFormat
+)
+
+var formatNames = map[Format]string{
+	TextFormat:   "text",
+	CSVFormat:    "csv",
+	TSVFormat:    "tsv",
+	TableFormat:  "table",
+	JSONFormat:   "json",
+	LogfmtFormat: "logfmt",
+}
+
+// ParseFormat parses the name of an output format, like "csv".
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%w:%s", InvalidFormatErr, name)
+}
+
+// String returns the name of the format.
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// WithOutput configures the format used to write the transformed
+// JSON objects. The default is TextFormat. When using a template the
+// whole rendered template is handled as a single field.
+func WithOutput(f Format) Option {
+	return func(j *J) {
+		j.format = f
+	}
+}
+
+// WithHeader configures the transformer to write a header with the
+// field selectors before anything else. It is ignored by TextFormat
+// and when using a template, TableFormat always has a header
+// (unless using WithoutHeader).
+func WithHeader() Option {
+	return func(j *J) {
+		j.header = true
+	}
+}
+
+// WithoutHeader configures the transformer to never write a header,
+// not even with TableFormat, like when its output continues the output
+// of another transformer that already wrote the header.
+func WithoutHeader() Option {
+	return func(j *J) {
+		j.noHeader = true
+	}
+}
+
+// WithTableWindow configures how many records are used to compute
+// the columns widths of TableFormat. The first records are only written
+// when the window is full (or the input ends, or data that is not JSON
+// is found, or the input stalls waiting for more data). After that each
+// record is written right away, aligned with the ones before it on the
+// window. The default is 50.
+func WithTableWindow(records int) Option {
+	return func(j *J) {
+		j.tableWindow = records
+	}
+}
+
+// field is a selected field.
+type field struct {
+	// name is the selector used to select the field.
+	name string
+	// value is the field rendered as text.
+	value string
+	// raw is the selected value, if the field is not missing.
+	raw interface{}
+	ok  bool
+	// color is the ANSI color of the field, if the output is colored.
+	color string
+}
+
+// encoder writes the fields selected from each JSON object.
+type encoder interface {
+	// header is called with the names of the fields before any record,
+	// the encoder decides if a header is written.
+	header(names []string) error
+	record(fields []field) error
+	// flush writes any buffered records. It is called before data that
+	// is not JSON is echoed, to keep the order of the input, and when
+	// the input ends.
+	flush() error
+}
+
+// rawEncoder is implemented by the encoders that write the lines of data
+// that is not JSON themselves, since echoing them as they are would break
+// the format. Empty lines are skipped, they are not given to raw.
+type rawEncoder interface {
+	raw(line []byte) error
+}
+
+func (j J) newEncoder(w io.Writer) encoder {
+	columns := len(j.fieldSelectors)
+	if j.tmpl != nil {
+		columns = 1
+	}
+	switch j.format {
+	case CSVFormat:
+		return newCSVEncoder(w, ',', j.header && !j.noHeader, columns)
+	case TSVFormat:
+		return newCSVEncoder(w, '\t', j.header && !j.noHeader, columns)
+	case TableFormat:
+		return newTableEncoder(w, j.tableWindow, !j.noHeader)
+	case JSONFormat:
+		return newJSONEncoder(w, j.fieldSelectors, j.flatten)
+	case LogfmtFormat:
+		return newLogfmtEncoder(w, j.fieldSelectors)
+	}
+	return textEncoder{w: w, separator: j.separator}
+}
+
+func fieldValues(fields []field) []string {
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = f.value
+	}
+	return values
+}
+
+type textEncoder struct {
+	w         io.Writer
+	separator string
+}
+
+func (e textEncoder) header([]string) error {
+	return nil
+}
+
+func (e textEncoder) record(fields []field) error {
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = colorize(f.color, f.value)
+	}
+	_, err := io.WriteString(e.w, strings.Join(values, e.separator)+"\n")
+	return err
+}
+
+func (e textEncoder) flush() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w          *csv.Writer
+	withHeader bool
+	// columns is how many fields each record has.
+	columns int
+}
+
+func newCSVEncoder(w io.Writer, comma rune, withHeader bool, columns int) csvEncoder {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	return csvEncoder{w: cw, withHeader: withHeader, columns: columns}
+}
+
+func (e csvEncoder) header(names []string) error {
+	if !e.withHeader {
+		return nil
+	}
+	return e.write(names)
+}
+
+func (e csvEncoder) record(fields []field) error {
+	return e.write(fieldValues(fields))
+}
+
+func (e csvEncoder) flush() error {
+	return nil
+}
+
+// raw writes the line as a record with the line as the first field and
+// the other fields empty, so all records have the same number of fields.
+func (e csvEncoder) raw(line []byte) error {
+	values := make([]string, e.columns)
+	values[0] = string(line)
+	return e.write(values)
+}
+
+func (e csvEncoder) write(values []string) error {
+	if err := e.w.Write(values); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// defaultTableWindow is how many records are used
+// to compute the columns widths of a table.
+const defaultTableWindow = 50
+
+// tableColumnsGap is written between the columns of a table.
+const tableColumnsGap = "  "
+
+// tableEncoder aligns the fields in columns. The width of each
+// column is the largest value on the window of the last records,
+// and never smaller than the header (even if it is not written).
+// The last column is not padded.
+type tableEncoder struct {
+	w          io.Writer
+	size       int
+	withHeader bool
+	names      []field
+	window     [][]field
+	// started is true after the header and
+	// the first window of records were written.
+	started bool
+	// buffered is how many records on the window
+	// were not written yet.
+	buffered int
+}
+
+func newTableEncoder(w io.Writer, size int, withHeader bool) *tableEncoder {
+	if size <= 0 {
+		size = defaultTableWindow
+	}
+	return &tableEncoder{w: w, size: size, withHeader: withHeader}
+}
+
+func (e *tableEncoder) header(names []string) error {
+	e.names = make([]field, len(names))
+	for i, name := range names {
+		e.names[i] = field{value: name}
+	}
+	return nil
+}
+
+func (e *tableEncoder) record(fields []field) error {
+	if len(e.window) == e.size {
+		e.window = e.window[1:]
+	}
+	e.window = append(e.window, fields)
+
+	if !e.started {
+		e.buffered++
+		if e.buffered < e.size {
+			return nil
+		}
+		return e.flush()
+	}
+	return e.writeRows(e.window[len(e.window)-1:])
+}
+
+func (e *tableEncoder) flush() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	if e.withHeader && len(e.names) > 0 {
+		if err := e.writeRows([][]field{e.names}); err != nil {
+			return err
+		}
+	}
+	rows := e.window[len(e.window)-e.buffered:]
+	e.buffered = 0
+	return e.writeRows(rows)
+}
+
+func (e *tableEncoder) writeRows(rows [][]field) error {
+	widths := e.widths()
+	var line strings.Builder
+	for _, row := range rows {
+		line.Reset()
+		for i, f := range row {
+			if i > 0 {
+				line.WriteString(tableColumnsGap)
+			}
+			line.WriteString(colorize(f.color, f.value))
+			if i < len(row)-1 && i < len(widths) {
+				line.WriteString(padding(widths[i], f.value))
+			}
+		}
+		line.WriteByte('\n')
+		if _, err := io.WriteString(e.w, line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *tableEncoder) widths() []int {
+	widths := make([]int, len(e.names))
+	for i, name := range e.names {
+		widths[i] = utf8.RuneCountInString(name.value)
+	}
+	for _, row := range e.window {
+		for i, f := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := utf8.RuneCountInString(f.value); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	return widths
+}
+
+// jsonEncoder writes the fields as a JSON object, with the keys in the
+// same order as the selectors.
+type jsonEncoder struct {
+	w io.Writer
+	// keys has the path of keys of each field on the object.
+	keys [][]string
+}
+
+func newJSONEncoder(w io.Writer, selectors []Selector, flatten bool) jsonEncoder {
+	keys := make([][]string, len(selectors))
+	for i, sel := range selectors {
+		keys[i] = []string{sel.String()}
+		if path, ok := sel.keys(); ok && !flatten {
+			keys[i] = path
+		}
+	}
+	return jsonEncoder{w: w, keys: keys}
+}
+
+func (e jsonEncoder) header([]string) error {
+	return nil
+}
+
+func (e jsonEncoder) record(fields []field) error {
+	obj := &jsonObject{}
+	for i, f := range fields {
+		if f.ok {
+			obj.set(e.keys[i], f.name, f.raw)
+		}
+	}
+	var buf strings.Builder
+	obj.encode(&buf)
+	buf.WriteByte('\n')
+	_, err := io.WriteString(e.w, buf.String())
+	return err
+}
+
+func (e jsonEncoder) flush() error {
+	return nil
+}
+
+// raw writes the line as a JSON object like {"_raw":"line"}.
+func (e jsonEncoder) raw(line []byte) error {
+	_, err := io.WriteString(e.w, compactJSON(rawData{Raw: string(line)})+"\n")
+	return err
+}
+
+// rawData is data that is not JSON wrapped as a JSON object.
+type rawData struct {
+	Raw string `json:"_raw"`
+}
+
+// jsonObject is a JSON object that keeps the order of its keys.
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// set sets the value on the given path of keys, creating the nested
+// objects as needed. If the path conflicts with a value that is already
+// set (like "a" and "a.b") the value is set with name as the key.
+func (o *jsonObject) set(path []string, name string, v interface{}) {
+	obj := o
+	for _, key := range path[:len(path)-1] {
+		nested, ok := obj.values[key].(*jsonObject)
+		if !ok {
+			if _, exists := obj.values[key]; exists {
+				o.put(name, v)
+				return
+			}
+			nested = &jsonObject{}
+			obj.put(key, nested)
+		}
+		obj = nested
+	}
+	key := path[len(path)-1]
+	if _, exists := obj.values[key]; exists {
+		o.put(name, v)
+		return
+	}
+	obj.put(key, v)
+}
+
+func (o *jsonObject) put(key string, v interface{}) {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *jsonObject) encode(buf *strings.Builder) {
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(compactJSON(key))
+		buf.WriteByte(':')
+		if nested, ok := o.values[key].(*jsonObject); ok {
+			nested.encode(buf)
+			continue
+		}
+		buf.WriteString(compactJSON(o.values[key]))
+	}
+	buf.WriteByte('}')
+}
+
+// logfmtEncoder writes the fields as logfmt key=value pairs.
+type logfmtEncoder struct {
+	w    io.Writer
+	keys []string
+}
+
+func newLogfmtEncoder(w io.Writer, selectors []Selector) logfmtEncoder {
+	keys := make([]string, len(selectors))
+	for i, sel := range selectors {
+		key := sel.rawPaths
+		if path, ok := sel.keys(); ok {
+			key = strings.Join(path, ".")
+		}
+		keys[i] = logfmtKey(key)
+	}
+	return logfmtEncoder{w: w, keys: keys}
+}
+
+// logfmtKey replaces the characters that
+// can't be used on logfmt keys with "_".
+func logfmtKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if needsLogfmtQuote(r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func (e logfmtEncoder) header([]string) error {
+	return nil
+}
+
+func (e logfmtEncoder) record(fields []field) error {
+	var line strings.Builder
+	for i, f := range fields {
+		if !f.ok {
+			continue
+		}
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		value := f.value
+		if s, ok := f.raw.(string); ok {
+			// Quoting escapes newlines the logfmt way
+			value = s
+		}
+		line.WriteString(e.keys[i])
+		line.WriteByte('=')
+		line.WriteString(quoteLogfmtValue(value))
+	}
+	line.WriteByte('\n')
+	_, err := io.WriteString(e.w, line.String())
+	return err
+}
+
+func (e logfmtEncoder) flush() error {
+	return nil
+}
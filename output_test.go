@@ -0,0 +1,541 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestOutputFormats(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		format   jtoh.Format
+		header   bool
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "CSV",
+			selector: ":msg:user",
+			format:   jtoh.CSVFormat,
+			input:    []string{`{"msg":"hello","user":"alice"}`},
+			want:     []string{"hello,alice"},
+		},
+		{
+			name:     "CSVQuotesSpecialChars",
+			selector: ":msg:user:n",
+			format:   jtoh.CSVFormat,
+			input: []string{
+				`{"msg":"a, b","user":"say \"hi\"","n":1}`,
+				`{"msg":" leading space","user":"tab\there","n":2}`,
+			},
+			want: []string{
+				`"a, b","say ""hi""",1`,
+				`" leading space",tab	here,2`,
+			},
+		},
+		{
+			name:     "CSVKeepsNewlinesEscaped",
+			selector: ":msg",
+			format:   jtoh.CSVFormat,
+			input:    []string{`{"msg":"first\nsecond"}`},
+			want:     []string{`first\nsecond`},
+		},
+		{
+			name:     "CSVWithHeader",
+			selector: `:msg:user.name:"a,b"`,
+			format:   jtoh.CSVFormat,
+			header:   true,
+			input:    []string{`{"msg":"hello","user":{"name":"alice"},"a,b":1}`},
+			want:     []string{`msg,user.name,"""a,b"""`, "hello,alice,1"},
+		},
+		{
+			name:     "CSVHeaderWithNoRecords",
+			selector: ":msg:user",
+			format:   jtoh.CSVFormat,
+			header:   true,
+			input:    []string{},
+			want:     []string{"msg,user"},
+		},
+		{
+			name:     "CSVWritesNonJSONAsRecords",
+			selector: ":msg:n",
+			format:   jtoh.CSVFormat,
+			header:   true,
+			input:    []string{"not, json", `{"msg":"a,b","n":1}`, "", `again "not" json`},
+			want:     []string{"msg,n", `"not, json",`, `"a,b",1`, `"again ""not"" json",`},
+		},
+		{
+			name:     "CSVMissingFieldAndDefault",
+			selector: ":msg:user?=",
+			format:   jtoh.CSVFormat,
+			input:    []string{`{}`},
+			want:     []string{`"<jtoh:missing field ""msg"">",`},
+		},
+		{
+			name:     "TSV",
+			selector: ":msg:user",
+			format:   jtoh.TSVFormat,
+			header:   true,
+			input: []string{
+				`{"msg":"a, b","user":"alice"}`,
+				`{"msg":"tab\there","user":"say \"hi\""}`,
+			},
+			want: []string{
+				"msg\tuser",
+				"a, b\talice",
+				"\"tab\there\"\t\"say \"\"hi\"\"\"",
+			},
+		},
+		{
+			name:     "TextIgnoresHeader",
+			selector: ":msg:user",
+			format:   jtoh.TextFormat,
+			header:   true,
+			input:    []string{`{"msg":"a:b","user":"alice"}`},
+			want:     []string{"a:b:alice"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := []jtoh.Option{jtoh.WithOutput(test.format)}
+			if test.header {
+				opts = append(opts, jtoh.WithHeader())
+			}
+			j, err := jtoh.New(test.selector, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(strings.Join(test.input, "\n")), output)
+
+			want := strings.Join(test.want, "\n") + "\n"
+			if output.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+			}
+		})
+	}
+}
+
+func TestCSVOutputWithNonJSONCanBeParsed(t *testing.T) {
+	for _, format := range []jtoh.Format{jtoh.CSVFormat, jtoh.TSVFormat} {
+		t.Run(format.String(), func(t *testing.T) {
+			j, err := jtoh.New(":msg:n", jtoh.WithOutput(format), jtoh.WithHeader())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			input := strings.Join([]string{
+				`{"msg":"x","n":1}`,
+				"plain\ttext, with \"quotes\"",
+				"",
+				`{"msg":"y","n":2} trailing`,
+			}, "\n")
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(input), output)
+
+			r := csv.NewReader(output)
+			if format == jtoh.TSVFormat {
+				r.Comma = '\t'
+			}
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("parsing %v output: %v", format, err)
+			}
+			want := [][]string{
+				{"msg", "n"},
+				{"x", "1"},
+				{"plain\ttext, with \"quotes\"", ""},
+				{"y", "2"},
+				{" trailing", ""},
+			}
+			if !reflect.DeepEqual(records, want) {
+				t.Errorf("got %q want %q", records, want)
+			}
+		})
+	}
+}
+
+func TestOutputFormatWithTemplate(t *testing.T) {
+	j, err := jtoh.NewTemplate(`{{.msg}}, {{.user}}`, jtoh.WithOutput(jtoh.CSVFormat), jtoh.WithHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(`{"msg":"hello","user":"alice"}`), output)
+
+	want := "\"hello, alice\"\n"
+	if output.String() != want {
+		t.Errorf("got %q; want %q", output.String(), want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, want := range []jtoh.Format{jtoh.TextFormat, jtoh.CSVFormat, jtoh.TSVFormat, jtoh.TableFormat, jtoh.JSONFormat, jtoh.LogfmtFormat} {
+		got, err := jtoh.ParseFormat(want.String())
+		if err != nil {
+			t.Errorf("ParseFormat(%q): unexpected error [%v]", want, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseFormat(%q): got %v want %v", want, got, want)
+		}
+	}
+
+	if _, err := jtoh.ParseFormat("xml"); !errors.Is(err, jtoh.InvalidFormatErr) {
+		t.Errorf("got err[%v] want[%v]", err, jtoh.InvalidFormatErr)
+	}
+}
+
+func TestTableOutput(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		window   int
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "AlignsColumns",
+			selector: ":ts:severity:msg",
+			input: []string{
+				`{"ts":"10:00","severity":"INFO","msg":"started"}`,
+				`{"ts":"10:01","severity":"WARNING","msg":"slow request"}`,
+			},
+			want: []string{
+				"ts     severity  msg",
+				"10:00  INFO      started",
+				"10:01  WARNING   slow request",
+			},
+		},
+		{
+			name:     "NonASCIIValues",
+			selector: ":name:n",
+			input: []string{
+				`{"name":"ação","n":1}`,
+				`{"name":"a","n":2}`,
+			},
+			want: []string{
+				"name  n",
+				"ação  1",
+				"a     2",
+			},
+		},
+		{
+			name:     "HeaderWithNoRecords",
+			selector: ":ts:msg",
+			input:    []string{},
+			want:     []string{"ts  msg"},
+		},
+		{
+			name:     "SlidingWindow",
+			selector: ":pod:msg",
+			window:   2,
+			input: []string{
+				`{"pod":"a","msg":"1"}`,
+				`{"pod":"a-long-pod-name","msg":"2"}`,
+				`{"pod":"b","msg":"3"}`,
+				`{"pod":"c","msg":"4"}`,
+			},
+			want: []string{
+				"pod              msg",
+				"a                1",
+				"a-long-pod-name  2",
+				"b                3",
+				"c    4",
+			},
+		},
+		{
+			name:     "NonJSONFlushesRecords",
+			selector: ":pod:msg",
+			input: []string{
+				`{"pod":"a","msg":"1"}`,
+				`panic: oops`,
+				`{"pod":"a-long-pod-name","msg":"2"}`,
+			},
+			want: []string{
+				"pod  msg",
+				"a    1",
+				"",
+				"panic: oops",
+				"a-long-pod-name  2",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, err := jtoh.New(test.selector,
+				jtoh.WithOutput(jtoh.TableFormat),
+				jtoh.WithTableWindow(test.window),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(strings.Join(test.input, "\n")), output)
+
+			want := strings.Join(test.want, "\n") + "\n"
+			if output.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+			}
+		})
+	}
+}
+
+func TestWithoutHeader(t *testing.T) {
+	for _, format := range []jtoh.Format{jtoh.TableFormat, jtoh.CSVFormat} {
+		j, err := jtoh.New(":ts:msg", jtoh.WithOutput(format), jtoh.WithHeader(), jtoh.WithoutHeader())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output := &bytes.Buffer{}
+		j.Do(strings.NewReader(`{"ts":"10:00","msg":"started"}`), output)
+
+		want := "10:00  started\n"
+		if format == jtoh.CSVFormat {
+			want = "10:00,started\n"
+		}
+		if output.String() != want {
+			t.Errorf("%v: got %q want %q", format, output.String(), want)
+		}
+	}
+}
+
+func TestTableOutputIsWrittenWhenInputStalls(t *testing.T) {
+	j, err := jtoh.New(":a", jtoh.WithOutput(jtoh.TableFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "a\n1\n"
+	output := &syncBuffer{}
+	input := &checkReader{
+		reads: []string{`{"a":1}` + "\n", `{"a":2}` + "\n"},
+		check: func() {
+			// The next read waits for the table to be written,
+			// like a stream waiting for more data.
+			deadline := time.Now().Add(5 * time.Second)
+			for output.String() != want && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if output.String() != want {
+				t.Errorf("got %q written while the input stalls; want %q", output.String(), want)
+			}
+		},
+	}
+
+	if err := j.DoContext(context.Background(), input, output); err != nil {
+		t.Fatal(err)
+	}
+	if got := output.String(); got != want+"2\n" {
+		t.Errorf("got %q want %q", got, want+"2\n")
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be used concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(data)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestJSONOutput(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		flatten  bool
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "NestedFields",
+			selector: ":severity:resource.labels.pod:resource.labels.ns:resource.type",
+			input: []string{
+				`{"severity":"INFO","resource":{"type":"k8s","labels":{"pod":"api","ns":"prod","other":1}},"msg":"hi"}`,
+			},
+			want: []string{
+				`{"severity":"INFO","resource":{"labels":{"pod":"api","ns":"prod"},"type":"k8s"}}`,
+			},
+		},
+		{
+			name:     "FlattenedFields",
+			selector: ":severity:resource.labels.pod",
+			flatten:  true,
+			input:    []string{`{"severity":"INFO","resource":{"labels":{"pod":"api"}}}`},
+			want:     []string{`{"severity":"INFO","resource.labels.pod":"api"}`},
+		},
+		{
+			name:     "KeepsValuesAsJSON",
+			selector: ":n:big:ok:null:obj:list",
+			input:    []string{`{"n":1.50,"big":1594600000000000123,"ok":true,"null":null,"obj":{"a":"<b>"},"list":[1,"x"]}`},
+			want:     []string{`{"n":1.50,"big":1594600000000000123,"ok":true,"null":null,"obj":{"a":"<b>"},"list":[1,"x"]}`},
+		},
+		{
+			name:     "MissingFieldsAreOmitted",
+			selector: ":msg:user.id:user.name",
+			input:    []string{`{"user":{"name":"alice"}}`, `{}`},
+			want:     []string{`{"user":{"name":"alice"}}`, `{}`},
+		},
+		{
+			name:     "SelectorsThatAreNotKeysAreUsedAsKeys",
+			selector: ":msg|message:tags[0]:labels.*:..error:id?=none",
+			input:    []string{`{"message":"hi","tags":["a"],"labels":{"x":1},"nested":{"error":"e"}}`},
+			want:     []string{`{"msg|message":"hi","tags[0]":"a","labels.*":[1],"..error":"e","id":"none"}`},
+		},
+		{
+			name:     "FormattedNumbers",
+			selector: ":latency%.2f:status%5d",
+			input:    []string{`{"latency":1.2345,"status":200}`},
+			want:     []string{`{"latency":1.23,"status":"  200"}`},
+		},
+		{
+			name:     "ConflictingPaths",
+			selector: ":a:a.b",
+			input:    []string{`{"a":{"b":1}}`},
+			want:     []string{`{"a":{"b":1},"a.b":1}`},
+		},
+		{
+			name:     "NonJSONIsWrapped",
+			selector: ":msg",
+			input: []string{
+				"starting <app>",
+				`{"msg":"hi"}`,
+				"panic: oops",
+				"",
+				"\tat main.go:10",
+				`[{"msg":"hi"}]`,
+			},
+			want: []string{
+				`{"_raw":"starting <app>"}`,
+				`{"msg":"hi"}`,
+				`{"_raw":"panic: oops"}`,
+				`{"_raw":"\tat main.go:10"}`,
+				`{"_raw":"[{\"msg\":\"hi\"}]"}`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := []jtoh.Option{jtoh.WithOutput(jtoh.JSONFormat)}
+			if test.flatten {
+				opts = append(opts, jtoh.WithFlatten())
+			}
+			j, err := jtoh.New(test.selector, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(strings.Join(test.input, "\n")), output)
+
+			want := strings.Join(test.want, "\n") + "\n"
+			if output.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+			}
+		})
+	}
+}
+
+func TestJSONOutputWithTemplateFails(t *testing.T) {
+	_, err := jtoh.NewTemplate(`{{.msg}}`, jtoh.WithOutput(jtoh.JSONFormat))
+	if !errors.Is(err, jtoh.InvalidTemplateErr) {
+		t.Errorf("got err[%v] want[%v]", err, jtoh.InvalidTemplateErr)
+	}
+}
+
+func TestLogfmtOutput(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "Pairs",
+			selector: ":level:msg:resource.labels.pod:status",
+			input:    []string{`{"level":"info","msg":"request done","resource":{"labels":{"pod":"api"}},"status":200}`},
+			want:     []string{`level=info msg="request done" resource.labels.pod=api status=200`},
+		},
+		{
+			name:     "QuotesValues",
+			selector: ":a:b:c:d:e",
+			input:    []string{`{"a":"","b":"x=y","c":"say \"hi\"","d":"line1\nline2","e":"ação"}`},
+			want:     []string{`a="" b="x=y" c="say \"hi\"" d="line1\nline2" e=ação`},
+		},
+		{
+			name:     "ObjectsAreQuotedJSON",
+			selector: ":labels:tags",
+			input:    []string{`{"labels":{"app":"api"},"tags":[1,2]}`},
+			want:     []string{`labels="{\"app\":\"api\"}" tags=[1,2]`},
+		},
+		{
+			name:     "KeysWithoutFormatsAndDefaults",
+			selector: `:latency%.1f:user.id?=anonymous:msg|message:"a b"`,
+			input:    []string{`{"latency":1.25,"message":"hi","a b":1}`},
+			want:     []string{`latency=1.2 user.id=anonymous msg|message=hi a_b=1`},
+		},
+		{
+			name:     "MissingFieldsAreOmitted",
+			selector: ":level:msg",
+			input:    []string{`{"msg":"hi"}`, `{}`},
+			want:     []string{`msg=hi`, ``},
+		},
+		{
+			name:     "EchoesNonJSON",
+			selector: ":msg",
+			input:    []string{`panic: oops`, `{"msg":"hi"}`},
+			want:     []string{`panic: oops`, `msg=hi`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, err := jtoh.New(test.selector, jtoh.WithOutput(jtoh.LogfmtFormat))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(strings.Join(test.input, "\n")), output)
+
+			want := strings.Join(test.want, "\n") + "\n"
+			if output.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package jtoh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// defaultChunkSize is how much non JSON data, without a newline,
+// is buffered before being echoed.
+const defaultChunkSize = 64 * 1024
+
+// passthrough echoes runs of data that are not JSON objects.
+//
+// The data is written as soon as a complete line is available, or when
+// the buffered data is larger than the chunk size, so memory usage is
+// bounded no matter how large the run is. When the run ends (a JSON
+// object is found or the input ends) the rest of the run is written
+// followed by a newline, so the output is the same as if the whole run
+// had been buffered and written at once.
+//
+// When there is a line handler each complete line is given to it and
+// only echoed if not handled, like logfmt lines that are transformed.
+// Lines larger than the chunk size are always echoed.
+//
+// When the encoder is a rawEncoder, each line (or chunk) is written by
+// the encoder instead (like {"_raw":"line"} for JSON), and empty lines
+// are skipped.
+type passthrough struct {
+	w         io.Writer
+	buf       []byte
+	chunkSize int
+	raw       rawEncoder
+	// dim is true when the echoed lines are dimmed
+	// with ANSI escape codes.
+	dim   bool
+	stats *Stats
+	// enc is flushed before anything is echoed, so records
+	// it may be buffering are written on the right order.
+	enc encoder
+	// beforeEcho is called before anything is echoed, so
+	// records waiting for more lines are written first.
+	beforeEcho func() error
+	// handleLine returns true if it handled the line,
+	// in which case the line is not echoed.
+	handleLine func(line []byte) (bool, error)
+	// running is true when some data of the current run was
+	// already received, even if it was already written.
+	running bool
+	// echoed is true when some data of the current run was echoed.
+	echoed bool
+	// partial is true when the beginning of the current line
+	// was already echoed, since it was larger than the chunk size.
+	partial bool
+	// written is how much of the current run was written.
+	written int
+}
+
+func newPassthrough(w io.Writer, chunkSize int, enc encoder, stats *Stats) *passthrough {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	raw, _ := enc.(rawEncoder)
+	return &passthrough{
+		w:         w,
+		chunkSize: chunkSize,
+		raw:       raw,
+		enc:       enc,
+		stats:     stats,
+	}
+}
+
+// write adds data to the current run, writing all complete lines.
+func (p *passthrough) write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	p.running = true
+	p.buf = append(p.buf, data...)
+
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		return p.flush(len(p.buf)-len(data)+i+1, false)
+	}
+	if len(p.buf) >= p.chunkSize {
+		err := p.echo(p.buf)
+		p.discard(len(p.buf))
+		p.partial = true
+		return err
+	}
+	return nil
+}
+
+// end finishes the current run, if there is one,
+// writing what is left of it followed by a newline.
+func (p *passthrough) end() error {
+	if !p.running {
+		return nil
+	}
+	p.buf = append(p.buf, '\n')
+	err := p.flush(len(p.buf), true)
+	p.reset()
+	return err
+}
+
+// reset starts a new run.
+func (p *passthrough) reset() {
+	if p.echoed {
+		p.stats.NonJSON++
+	}
+	p.running = false
+	p.echoed = false
+	p.partial = false
+	p.written = 0
+}
+
+// flush writes the first n bytes of the buffer, which must end on a
+// newline, and discards them. Each line is given to the line handler,
+// if there is one, and consecutive lines that are not handled are
+// echoed together.
+//
+// Blank lines right before a handled line, or before the prefix of a
+// JSON object, are not echoed, just like whitespace between JSON
+// objects, so blank lines at the end are kept on the buffer until the
+// next line is available (unless the run is ending or there are too
+// many of them).
+func (p *passthrough) flush(n int, ending bool) error {
+	echoStart := 0
+	for pos := 0; pos < n && p.handleLine != nil; {
+		end := pos + bytes.IndexByte(p.buf[pos:n], '\n')
+		if p.partial {
+			p.partial = false
+			pos = end + 1
+			continue
+		}
+		handled, err := p.handleLine(p.buf[pos:end])
+		if err != nil {
+			return err
+		}
+		if handled {
+			if err := p.echo(trimBlankLines(p.buf[echoStart:pos])); err != nil {
+				return err
+			}
+			echoStart = end + 1
+		}
+		pos = end + 1
+	}
+
+	echoEnd := n
+	if !ending && n-echoStart < p.chunkSize {
+		echoEnd = echoStart + len(trimBlankLines(p.buf[echoStart:n]))
+	}
+	err := p.echo(p.buf[echoStart:echoEnd])
+	p.discard(echoEnd)
+	p.partial = false
+	return err
+}
+
+// line returns the current line, that has no newline yet, or nil if
+// its beginning was already echoed. The returned data is only valid
+// until the passthrough is changed.
+func (p *passthrough) line() []byte {
+	if p.partial {
+		return nil
+	}
+	return p.buf[bytes.LastIndexByte(p.buf, '\n')+1:]
+}
+
+// cutLine removes the current line from the run, like when it is
+// the prefix of a JSON object. If only blank lines are left the
+// run is handled as if it was just whitespace before the object.
+func (p *passthrough) cutLine() {
+	if p.partial {
+		return
+	}
+	start := bytes.LastIndexByte(p.buf, '\n') + 1
+	if len(bytes.TrimSpace(p.buf[:start])) == 0 {
+		p.buf = p.buf[:0]
+		p.reset()
+		return
+	}
+	// The newline is added back when the run ends.
+	p.buf = p.buf[:start-1]
+}
+
+// trimBlankLines removes the lines at the end of data that
+// only have spaces. Data must end with a newline.
+func trimBlankLines(data []byte) []byte {
+	end := len(data)
+	for end > 0 && isSpace(data[end-1]) {
+		end--
+	}
+	if end == 0 {
+		return nil
+	}
+	return data[:end+bytes.IndexByte(data[end:], '\n')+1]
+}
+
+// echo writes data that is not JSON.
+func (p *passthrough) echo(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if p.beforeEcho != nil {
+		if err := p.beforeEcho(); err != nil {
+			return err
+		}
+	}
+	if err := p.enc.flush(); err != nil {
+		return err
+	}
+	p.echoed = true
+
+	var (
+		wrote int
+		err   error
+	)
+	switch {
+	case p.raw != nil:
+		wrote, err = p.writeRaw(data)
+	case p.dim:
+		wrote, err = p.writeDimmed(data)
+	default:
+		wrote, err = p.w.Write(data)
+	}
+	p.written += wrote
+	if err != nil {
+		return fmt.Errorf("writing non JSON data: wrote %d bytes: %w", p.written, err)
+	}
+	return nil
+}
+
+// discard removes the first n bytes of the buffer.
+func (p *passthrough) discard(n int) {
+	rest := copy(p.buf, p.buf[n:])
+	p.buf = p.buf[:rest]
+}
+
+// writeRaw writes each line of data with the encoder, returning
+// how much of data was written.
+func (p *passthrough) writeRaw(data []byte) (int, error) {
+	wrote := 0
+	for len(data) > 0 {
+		line := data
+		next := len(data)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i]
+			next = i + 1
+		}
+		if len(line) > 0 {
+			if err := p.raw.raw(line); err != nil {
+				return wrote, err
+			}
+		}
+		wrote += next
+		data = data[next:]
+	}
+	return wrote, nil
+}
+
+// writeDimmed writes each line of data dimmed, returning
+// how much of data was written.
+func (p *passthrough) writeDimmed(data []byte) (int, error) {
+	var dimmed bytes.Buffer
+	size := len(data)
+	for len(data) > 0 {
+		line := data
+		next := len(data)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i]
+			next = i + 1
+		}
+		if len(line) > 0 {
+			dimmed.WriteString(colorDim)
+			dimmed.Write(line)
+			dimmed.WriteString(colorReset)
+		}
+		if next > len(line) {
+			dimmed.WriteByte('\n')
+		}
+		data = data[next:]
+	}
+	if _, err := p.w.Write(dimmed.Bytes()); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
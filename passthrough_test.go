@@ -0,0 +1,156 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestPassthroughOutputDoesNotDependOnChunkSize(t *testing.T) {
+	inputs := []string{
+		"plain message\nanother one\n",
+		"no newline at all",
+		`start{"a":"first"}middle` + "\n" + `{"a":"second"}` + "end\nof\ninput",
+		`[{"a":"first"},garbage{"a":"second"}]`,
+		`{"a":1`,
+		"\n\nblank lines\n\n\n",
+	}
+
+	for _, input := range inputs {
+		j, err := jtoh.New(":a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &bytes.Buffer{}
+		if err := j.DoContext(context.Background(), strings.NewReader(input), want); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, chunkSize := range []int{1, 2, 3, 7} {
+			j, err := jtoh.New(":a", jtoh.WithPassthroughChunkSize(chunkSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := &bytes.Buffer{}
+			reader := iotest.OneByteReader(strings.NewReader(input))
+			if err := j.DoContext(context.Background(), reader, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("input %q chunk size %d: got %q; want %q",
+					input, chunkSize, got.String(), want.String())
+			}
+		}
+	}
+}
+
+func TestPassthroughIsBounded(t *testing.T) {
+	const (
+		chunkSize = 100
+		inputSize = 1024 * 1024
+	)
+
+	j, err := jtoh.New(":a", jtoh.WithPassthroughChunkSize(chunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &repeatReader{data: []byte("not json"), size: inputSize}
+	output := &writesRecorder{}
+	if err := j.DoContext(context.Background(), input, output); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scanner reads blocks of up to 64KB, so text tokens can be that
+	// large, but they must not accumulate while the run goes on.
+	const maxWrite = 64*1024 + chunkSize
+	if output.maxWrite > maxWrite {
+		t.Errorf("got a write of %d bytes; want at most %d", output.maxWrite, maxWrite)
+	}
+	if output.total != inputSize+1 {
+		t.Errorf("got %d bytes written; want %d", output.total, inputSize+1)
+	}
+}
+
+func TestPassthroughEchoesLinesBeforeInputEnds(t *testing.T) {
+	j, err := jtoh.New(":a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := &bytes.Buffer{}
+	input := &checkReader{
+		reads: []string{"first line\nsecond", " line\n"},
+		check: func() {
+			if output.String() != "first line\n" {
+				t.Errorf("got %q echoed before second read; want %q",
+					output.String(), "first line\n")
+			}
+		},
+	}
+
+	if err := j.DoContext(context.Background(), input, output); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "first line\nsecond line\n"
+	if output.String() != want {
+		t.Errorf("got %q; want %q", output.String(), want)
+	}
+}
+
+type repeatReader struct {
+	data []byte
+	size int
+	read int
+}
+
+func (r *repeatReader) Read(data []byte) (int, error) {
+	if r.read == r.size {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(data) && r.read < r.size {
+		data[n] = r.data[r.read%len(r.data)]
+		n++
+		r.read++
+	}
+	return n, nil
+}
+
+type writesRecorder struct {
+	total    int
+	maxWrite int
+}
+
+func (w *writesRecorder) Write(data []byte) (int, error) {
+	w.total += len(data)
+	if len(data) > w.maxWrite {
+		w.maxWrite = len(data)
+	}
+	return len(data), nil
+}
+
+// checkReader calls check before each read, except the first one.
+type checkReader struct {
+	reads []string
+	check func()
+	count int
+}
+
+func (r *checkReader) Read(data []byte) (int, error) {
+	if r.count == len(r.reads) {
+		return 0, io.EOF
+	}
+	if r.count > 0 {
+		r.check()
+	}
+	n := copy(data, r.reads[r.count])
+	r.count++
+	return n, nil
+}
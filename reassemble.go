@@ -0,0 +1,181 @@
+package jtoh
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+const (
+	// defaultMaxContainerLogSize is the default maximum size
+	// of the container logs reassembled from partial lines.
+	defaultMaxContainerLogSize = 1024 * 1024
+	// reassemblerLineSize is how large lines can be to be checked for
+	// partial container logs, larger lines are read as they are.
+	reassemblerLineSize = 256 * 1024
+)
+
+// WithMaxContainerLogSize configures the maximum size of the container
+// logs reassembled from partial lines (see WithContainerLogs). Logs that
+// get larger are handled as if they were complete, even if there are
+// more partial lines of them. The default is 1MiB.
+func WithMaxContainerLogSize(size int) Option {
+	return func(j *J) {
+		j.maxContainerLogSize = size
+	}
+}
+
+// reassembler reads container logs joining the partial lines of the
+// long logs, so the logs can be parsed as JSON. Container runtimes
+// split long logs on many lines: CRI marks all lines but the last one
+// with the P tag and Docker json-file splits them on many entries where
+// only the last one ends with a newline.
+//
+// The partial lines are joined as a single line, with the timestamp of
+// the first one, on the same format. Any other line is read as it is.
+type reassembler struct {
+	r       *bufio.Reader
+	maxSize int
+	out     bytes.Buffer
+	err     error
+	// long is true while reading a line that is too large
+	// to be checked, so the rest of it is read as it is.
+	long bool
+	// cri and docker are the partial logs, by stream.
+	cri    map[string]*partialLog
+	docker map[string]*partialLog
+}
+
+// partialLog is a log being reassembled.
+type partialLog struct {
+	ts    string
+	data  []byte
+	entry map[string]interface{}
+}
+
+func newReassembler(r io.Reader, maxSize int) *reassembler {
+	if maxSize <= 0 {
+		maxSize = defaultMaxContainerLogSize
+	}
+	return &reassembler{
+		r:       bufio.NewReaderSize(r, reassemblerLineSize),
+		maxSize: maxSize,
+		cri:     map[string]*partialLog{},
+		docker:  map[string]*partialLog{},
+	}
+}
+
+func (a *reassembler) Read(p []byte) (int, error) {
+	for a.out.Len() == 0 {
+		if a.err != nil {
+			return 0, a.err
+		}
+		a.readLine()
+	}
+	return a.out.Read(p)
+}
+
+// readLine reads the next line, writing it to the output
+// unless it is a partial log.
+func (a *reassembler) readLine() {
+	line, err := a.r.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull:
+		a.out.Write(line)
+		a.long = true
+		return
+	case a.long:
+		a.out.Write(line)
+		a.long = false
+	case len(line) > 0:
+		a.handleLine(line)
+	}
+
+	if err != nil {
+		if err == io.EOF {
+			a.flush()
+		}
+		a.err = err
+	}
+}
+
+// handleLine handles a complete line, that may
+// be missing the newline if it is the last one.
+func (a *reassembler) handleLine(line []byte) {
+	content := bytes.TrimSuffix(line, []byte{'\n'})
+
+	if ts, stream, tag, data, ok := parseCRILine(content); ok {
+		partial, found := a.cri[stream]
+		if !found && tag == criFull {
+			a.out.Write(line)
+			return
+		}
+		if !found {
+			partial = &partialLog{ts: ts}
+			a.cri[stream] = partial
+		}
+		partial.data = append(partial.data, data...)
+		if tag == criFull || len(partial.data) >= a.maxSize {
+			a.writeCRI(stream, partial)
+		}
+		return
+	}
+
+	if !bytes.HasPrefix(content, []byte(`{"log":`)) {
+		a.out.Write(line)
+		return
+	}
+	entry := map[string]interface{}{}
+	if decodeObject(content, &entry) != nil {
+		a.out.Write(line)
+		return
+	}
+	log, stream, ts, ok := dockerEntry(entry)
+	if !ok {
+		a.out.Write(line)
+		return
+	}
+
+	complete := len(log) > 0 && log[len(log)-1] == '\n'
+	partial, found := a.docker[stream]
+	if !found && complete {
+		a.out.Write(line)
+		return
+	}
+	if !found {
+		partial = &partialLog{ts: ts, entry: entry}
+		a.docker[stream] = partial
+	}
+	partial.data = append(partial.data, log...)
+	if complete || len(partial.data) >= a.maxSize {
+		a.writeDocker(stream, partial)
+	}
+}
+
+// flush writes the logs that are still partial, since
+// the input ended, as if they were complete.
+func (a *reassembler) flush() {
+	for _, stream := range []string{"stdout", "stderr"} {
+		if partial, ok := a.cri[stream]; ok {
+			a.writeCRI(stream, partial)
+		}
+		if partial, ok := a.docker[stream]; ok {
+			a.writeDocker(stream, partial)
+		}
+	}
+}
+
+func (a *reassembler) writeCRI(stream string, partial *partialLog) {
+	delete(a.cri, stream)
+	a.out.WriteString(partial.ts + " " + stream + " " + criFull + " ")
+	a.out.Write(partial.data)
+	a.out.WriteByte('\n')
+}
+
+func (a *reassembler) writeDocker(stream string, partial *partialLog) {
+	delete(a.docker, stream)
+	partial.entry["log"] = string(partial.data)
+	partial.entry["time"] = partial.ts
+	a.out.WriteString(compactJSON(partial.entry))
+	a.out.WriteByte('\n')
+}
@@ -0,0 +1,175 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestContainerLogsReassembly(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		maxSize  int
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "CRIPartialLines",
+			selector: ":_ts:_stream:msg",
+			input: []string{
+				`2024-01-01T00:00:00Z stdout P {"msg":`,
+				`2024-01-01T00:00:01Z stdout P "long `,
+				`2024-01-01T00:00:02Z stdout F message"}`,
+				`2024-01-01T00:00:03Z stdout F {"msg":"short"}`,
+			},
+			want: []string{
+				"2024-01-01T00:00:00Z:stdout:long message",
+				"2024-01-01T00:00:03Z:stdout:short",
+			},
+		},
+		{
+			name:     "CRIInterleavedStreams",
+			selector: ":_stream:msg",
+			input: []string{
+				`2024-01-01T00:00:00Z stdout P {"msg":"out`,
+				`2024-01-01T00:00:00Z stderr P {"msg":"err`,
+				`2024-01-01T00:00:01Z stderr F or"}`,
+				`2024-01-01T00:00:01Z stdout F put"}`,
+			},
+			want: []string{
+				"stderr:error",
+				"stdout:output",
+			},
+		},
+		{
+			name:     "CRIPartialLinesOfText",
+			selector: ":msg",
+			input: []string{
+				`2024-01-01T00:00:00Z stderr P panic: `,
+				`2024-01-01T00:00:01Z stderr F boom`,
+			},
+			want: []string{"2024-01-01T00:00:00Z stderr F panic: boom"},
+		},
+		{
+			name:     "CRIPartialLinesAtTheEnd",
+			selector: ":msg",
+			input: []string{
+				`2024-01-01T00:00:00Z stdout P {"msg":`,
+				`2024-01-01T00:00:01Z stdout P "unfinished"}`,
+			},
+			want: []string{"unfinished"},
+		},
+		{
+			name:     "DockerSplitEntries",
+			selector: ":_ts:_stream:msg",
+			input: []string{
+				`{"log":"{\"msg\":","stream":"stdout","time":"2024-01-01T00:00:00Z"}`,
+				`{"log":"\"long ","stream":"stdout","time":"2024-01-01T00:00:01Z"}`,
+				`{"log":"message\"}\n","stream":"stdout","time":"2024-01-01T00:00:02Z"}`,
+				`{"log":"{\"msg\":\"short\"}\n","stream":"stderr","time":"2024-01-01T00:00:03Z"}`,
+			},
+			want: []string{
+				"2024-01-01T00:00:00Z:stdout:long message",
+				"2024-01-01T00:00:03Z:stderr:short",
+			},
+		},
+		{
+			name:     "MaxSize",
+			selector: ":msg",
+			maxSize:  10,
+			input: []string{
+				`2024-01-01T00:00:00Z stdout P {"msg":`,
+				`2024-01-01T00:00:01Z stdout P "too long"}`,
+				`2024-01-01T00:00:02Z stdout F {"msg":"short"}`,
+			},
+			want: []string{
+				"too long",
+				"short",
+			},
+		},
+		{
+			name:     "MaxSizeOfText",
+			selector: ":msg",
+			maxSize:  10,
+			input: []string{
+				`2024-01-01T00:00:00Z stdout P 0123456789`,
+				`2024-01-01T00:00:01Z stdout F rest`,
+			},
+			want: []string{
+				"2024-01-01T00:00:00Z stdout F 0123456789",
+				"2024-01-01T00:00:01Z stdout F rest",
+			},
+		},
+		{
+			name:     "OtherLinesAreNotChanged",
+			selector: ":msg",
+			input: []string{
+				`{"msg":"json"}`,
+				`{"log":"not docker","stream":"stdout","time":"2024-01-01T00:00:00Z","msg":"json"}`,
+				`2024-01-01T00:00:00Z stdout X {"msg":"unknown tag"}`,
+			},
+			want: []string{
+				"json",
+				"json",
+				"",
+				"2024-01-01T00:00:00Z stdout X",
+				"unknown tag",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, err := jtoh.New(test.selector,
+				jtoh.WithContainerLogs(),
+				jtoh.WithMaxContainerLogSize(test.maxSize),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			input := strings.Join(test.input, "\n")
+			want := strings.Join(test.want, "\n") + "\n"
+
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(input), output)
+			if output.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+			}
+
+			output.Reset()
+			j.Do(iotest.OneByteReader(strings.NewReader(input)), output)
+			if output.String() != want {
+				t.Errorf("reading one byte at a time got:\n%s\nwant:\n%s", output.String(), want)
+			}
+		})
+	}
+}
+
+func TestContainerLogsLargeLinesAreNotChanged(t *testing.T) {
+	j, err := jtoh.New(":msg", jtoh.WithContainerLogs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := strings.Repeat("a", 1024*1024)
+	input := strings.Join([]string{
+		`{"msg":"` + large + `"}`,
+		large,
+		`{"msg":"after"}`,
+	}, "\n")
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(input), output)
+
+	want := large + "\n\n" + large + "\nafter\n"
+	if output.String() != want {
+		t.Errorf("got %d bytes want %d bytes", output.Len(), len(want))
+	}
+}
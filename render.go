@@ -0,0 +1,159 @@
+package jtoh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// renderValue renders a selected value as text. Strings, numbers,
+// booleans and null are rendered as they are, while objects and arrays
+// are rendered as compact JSON, or as a list of key=value pairs
+// when flatten is true.
+func renderValue(v interface{}, flatten bool) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		if flatten {
+			return flattenValue(v)
+		}
+		return compactJSON(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// compactJSON renders the value as compact JSON. Unlike json.Marshal
+// it doesn't escape HTML characters, since the output is just text.
+func compactJSON(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		// Decoded JSON values can always be encoded back
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// flattenValue renders objects and arrays as space separated key=value
+// pairs, where the keys are the path to each scalar value, like:
+//
+// a=1 b.c=2 list[0]=x
+//
+// Object keys are sorted and values with spaces or quotes are quoted.
+func flattenValue(v interface{}) string {
+	var pairs []string
+	flattenInto(&pairs, "", v)
+	return strings.Join(pairs, " ")
+}
+
+func flattenInto(pairs *[]string, prefix string, v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			*pairs = append(*pairs, flatPair(prefix, "{}"))
+			return
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenInto(pairs, name, val[key])
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			*pairs = append(*pairs, flatPair(prefix, "[]"))
+			return
+		}
+		for i, elem := range val {
+			flattenInto(pairs, prefix+"["+strconv.Itoa(i)+"]", elem)
+		}
+	case string:
+		*pairs = append(*pairs, flatPair(prefix, quoteLogfmtValue(val)))
+	default:
+		*pairs = append(*pairs, flatPair(prefix, fmt.Sprint(val)))
+	}
+}
+
+func flatPair(key, value string) string {
+	if key == "" {
+		return value
+	}
+	return key + "=" + value
+}
+
+// quoteLogfmtValue quotes the value following the logfmt rules, values
+// that are empty or have spaces, "=", quotes or control characters
+// are quoted.
+func quoteLogfmtValue(s string) string {
+	if s == "" || strings.IndexFunc(s, needsLogfmtQuote) >= 0 || !utf8.ValidString(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func needsLogfmtQuote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+}
+
+// formattedNumber is a number formatted by a selector. It is encoded
+// to JSON as a number when it is still a valid number after being
+// formatted (like "1.50"), or else as a string (like "  1.50").
+type formattedNumber string
+
+// MarshalJSON implements json.Marshaler.
+func (n formattedNumber) MarshalJSON() ([]byte, error) {
+	if isJSONNumber(string(n)) {
+		return []byte(n), nil
+	}
+	return json.Marshal(string(n))
+}
+
+func isJSONNumber(s string) bool {
+	return s != "" && (s[0] == '-' || isDigitByte(s[0])) && json.Valid([]byte(s))
+}
+
+// formatNumber formats a number using the given fmt format. Numbers
+// are handled with arbitrary precision, so big integers are formatted
+// exactly. Strings that are valid numbers are also formatted.
+// If the value is not a number it returns false.
+func formatNumber(v interface{}, format string) (string, bool) {
+	var number string
+	switch val := v.(type) {
+	case json.Number:
+		number = val.String()
+	case templateNumber:
+		number = val.String()
+	case string:
+		number = strings.TrimSpace(val)
+	case float64:
+		number = strconv.FormatFloat(val, 'g', -1, 64)
+	default:
+		return "", false
+	}
+
+	f, _, err := big.ParseFloat(number, 10, 256, big.ToNearestEven)
+	if err != nil || f.IsInf() {
+		return "", false
+	}
+
+	switch format[len(format)-1] {
+	case 'd', 'x', 'X', 'o', 'b':
+		i, ok := new(big.Int).SetString(number, 10)
+		if !ok {
+			i, _ = f.Int(nil)
+		}
+		return fmt.Sprintf(format, i), true
+	}
+	return fmt.Sprintf(format, f), true
+}
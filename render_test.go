@@ -0,0 +1,99 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestFlatten(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		input    string
+		want     string
+	}
+
+	tests := []Test{
+		{
+			name:     "Object",
+			selector: ":labels",
+			input:    `{"labels":{"b":2,"a":"x"}}`,
+			want:     "a=x b=2",
+		},
+		{
+			name:     "NestedObject",
+			selector: ":error",
+			input:    `{"error":{"code":500,"details":{"reason":"timeout","retry":true}}}`,
+			want:     "code=500 details.reason=timeout details.retry=true",
+		},
+		{
+			name:     "Array",
+			selector: ":tags",
+			input:    `{"tags":["a","b"]}`,
+			want:     "[0]=a [1]=b",
+		},
+		{
+			name:     "ArrayOfObjects",
+			selector: ":obj",
+			input:    `{"obj":{"spans":[{"id":1},{"id":2,"parent":null}]}}`,
+			want:     "spans[0].id=1 spans[1].id=2 spans[1].parent=<nil>",
+		},
+		{
+			name:     "QuotesValuesWithSpaces",
+			selector: ":obj",
+			input:    `{"obj":{"msg":"hello world","eq":"a=b","empty":"","nl":"a\nb"}}`,
+			want:     `empty="" eq="a=b" msg="hello world" nl="a\nb"`,
+		},
+		{
+			name:     "EmptyObjectAndArray",
+			selector: ":obj",
+			input:    `{"obj":{"a":{},"b":[]}}`,
+			want:     "a={} b=[]",
+		},
+		{
+			name:     "Scalars",
+			selector: ":str:num",
+			input:    `{"str":"hello world","num":1.5}`,
+			want:     "hello world:1.5",
+		},
+		{
+			name:     "MultipleValues",
+			selector: ":list[:2]",
+			input:    `{"list":["a","b","c"]}`,
+			want:     "[0]=a [1]=b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, err := jtoh.New(test.selector, jtoh.WithFlatten())
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := &bytes.Buffer{}
+			j.Do(strings.NewReader(test.input), output)
+
+			got := strings.TrimSuffix(output.String(), "\n")
+			if got != test.want {
+				t.Errorf("got %q; want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFlattenOnTemplate(t *testing.T) {
+	j, err := jtoh.NewTemplate(`{{sel "labels" .}}`, jtoh.WithFlatten())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(`{"labels":{"app":"web","tier":"db"}}`), output)
+
+	want := "app=web tier=db\n"
+	if output.String() != want {
+		t.Errorf("got %q; want %q", output.String(), want)
+	}
+}
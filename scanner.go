@@ -0,0 +1,541 @@
+package jtoh
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+const (
+	// scannerBlockSize is the size of the blocks read from the input.
+	scannerBlockSize = 64 * 1024
+	// stallTimeout is how long a read waits for
+	// data before the input is considered stalled.
+	stallTimeout = 100 * time.Millisecond
+	// maxNestingDepth is how deep JSON values can be nested,
+	// anything deeper is handled as non JSON data.
+	maxNestingDepth = 10000
+)
+
+type tokenKind int
+
+const (
+	// objectToken is a syntactically valid JSON object.
+	objectToken tokenKind = iota
+	// textToken is data that is not a JSON object and must be echoed.
+	textToken
+)
+
+type token struct {
+	kind tokenKind
+	data []byte
+}
+
+// scanner splits a stream of data, reading it in large blocks, into
+// JSON objects and chunks of data that are not JSON objects.
+//
+// The input can be a stream of JSON objects or a list of JSON objects,
+// which is detected by the first character of the input being '['.
+//
+// Anything that is not a JSON object is returned as text to be echoed,
+// exactly as it was found on the input. When some data looks like JSON,
+// like an unfinished object, all data until (and including) the first
+// invalid character is considered text and scanning restarts right
+// after it, which is how the JSON decoder from the standard library
+// would behave if it was restarted after each error.
+//
+// Whitespace (and the list commas/brackets) between JSON objects are
+// not echoed, unless it precedes data that is echoed.
+type scanner struct {
+	ctx context.Context
+	r   io.Reader
+	err error
+	// stalled, if set, is called when a read waits for data
+	// for longer than stallTimeout, like to write the data that
+	// is waiting for more input, and then the read goes on.
+	stalled func() error
+
+	buf []byte
+	// mark is where the token being scanned starts on buf.
+	mark int
+	// pos is the position on buf of the next byte to be scanned.
+	pos int
+
+	started     bool
+	list        bool
+	afterObject bool
+}
+
+func newScanner(ctx context.Context, r io.Reader) *scanner {
+	return &scanner{
+		ctx: ctx,
+		r:   r,
+		buf: make([]byte, 0, scannerBlockSize),
+	}
+}
+
+// next returns the next token on the stream. The data on the returned
+// token is only valid until next is called again.
+// When there is no more data it returns io.EOF.
+func (s *scanner) next() (token, error) {
+	if !s.started {
+		s.started = true
+		s.detectList()
+	}
+
+	s.mark = s.pos
+	afterObject := s.afterObject
+	s.afterObject = false
+
+	var c byte
+	for {
+		var ok bool
+		c, ok = s.peek()
+		if !ok {
+			return token{}, s.readErr()
+		}
+		if isSpace(c) {
+			s.pos++
+			continue
+		}
+		if s.list && (c == ']' || (c == ',' && afterObject)) {
+			// The list separator is only valid once after an object
+			afterObject = false
+			s.pos++
+			continue
+		}
+		break
+	}
+
+	valueStart := s.pos - s.mark
+	valid := s.value(0)
+
+	if !valid && s.err != nil && s.err != io.EOF {
+		return token{}, s.err
+	}
+
+	if valid && c == '{' {
+		s.afterObject = true
+		return token{kind: objectToken, data: s.buf[s.mark+valueStart : s.pos]}, nil
+	}
+	return token{kind: textToken, data: s.buf[s.mark:s.pos]}, nil
+}
+
+// detectList discards the spaces at the beginning of the input
+// and checks if the input is a list of JSON objects.
+func (s *scanner) detectList() {
+	for {
+		c, ok := s.peek()
+		if !ok {
+			return
+		}
+		if !isSpace(c) {
+			if c == '[' {
+				s.list = true
+				s.pos++
+			}
+			return
+		}
+		s.pos++
+	}
+}
+
+// value scans a JSON value. If the value is valid it returns true
+// leaving the scanner right after the value, or else it returns false
+// leaving the scanner right after the first invalid character.
+func (s *scanner) value(depth int) bool {
+	c, ok := s.peek()
+	if !ok {
+		return false
+	}
+
+	switch {
+	case c == '{':
+		return s.object(depth + 1)
+	case c == '[':
+		return s.array(depth + 1)
+	case c == '"':
+		return s.str()
+	case c == '-' || isDigitByte(c):
+		return s.number()
+	case c == 't':
+		return s.literal("true")
+	case c == 'f':
+		return s.literal("false")
+	case c == 'n':
+		return s.literal("null")
+	}
+
+	s.pos++
+	s.plainText()
+	return false
+}
+
+// plainText skips the buffered data that can't be the start of
+// a JSON value, since scanning would just fail on each byte of it.
+// It doesn't read more data, it is only an optimization to avoid
+// handling text that is not JSON one byte at a time.
+func (s *scanner) plainText() {
+	for s.pos < len(s.buf) && isPlainByte(s.buf[s.pos]) {
+		s.pos++
+	}
+}
+
+func (s *scanner) object(depth int) bool {
+	s.pos++
+	if depth > maxNestingDepth {
+		return false
+	}
+
+	c, ok := s.skipSpaces()
+	if !ok {
+		return false
+	}
+	if c == '}' {
+		s.pos++
+		return true
+	}
+
+	for {
+		if c != '"' {
+			s.pos++
+			return false
+		}
+		if !s.str() {
+			return false
+		}
+		if !s.expect(':') {
+			return false
+		}
+		if _, ok := s.skipSpaces(); !ok {
+			return false
+		}
+		if !s.value(depth) {
+			return false
+		}
+
+		c, ok = s.skipSpaces()
+		if !ok {
+			return false
+		}
+		s.pos++
+		if c == '}' {
+			return true
+		}
+		if c != ',' {
+			return false
+		}
+
+		c, ok = s.skipSpaces()
+		if !ok {
+			return false
+		}
+	}
+}
+
+func (s *scanner) array(depth int) bool {
+	s.pos++
+	if depth > maxNestingDepth {
+		return false
+	}
+
+	c, ok := s.skipSpaces()
+	if !ok {
+		return false
+	}
+	if c == ']' {
+		s.pos++
+		return true
+	}
+
+	for {
+		if !s.value(depth) {
+			return false
+		}
+
+		c, ok = s.skipSpaces()
+		if !ok {
+			return false
+		}
+		s.pos++
+		if c == ']' {
+			return true
+		}
+		if c != ',' {
+			return false
+		}
+
+		if _, ok := s.skipSpaces(); !ok {
+			return false
+		}
+	}
+}
+
+func (s *scanner) str() bool {
+	s.pos++
+	for {
+		// Fast path, scanning what is already buffered
+		for s.pos < len(s.buf) {
+			c := s.buf[s.pos]
+			if c == '"' || c == '\\' || c < 0x20 {
+				break
+			}
+			s.pos++
+		}
+
+		c, ok := s.peek()
+		if !ok {
+			return false
+		}
+		s.pos++
+
+		switch {
+		case c == '"':
+			return true
+		case c < 0x20:
+			return false
+		case c == '\\':
+			c, ok := s.peek()
+			if !ok {
+				return false
+			}
+			s.pos++
+			switch c {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				for i := 0; i < 4; i++ {
+					c, ok := s.peek()
+					if !ok {
+						return false
+					}
+					s.pos++
+					if !isHexByte(c) {
+						return false
+					}
+				}
+			default:
+				return false
+			}
+		}
+	}
+}
+
+func (s *scanner) number() bool {
+	c, _ := s.peek()
+	if c == '-' {
+		s.pos++
+		var ok bool
+		if c, ok = s.peek(); !ok {
+			return false
+		}
+	}
+
+	s.pos++
+	switch {
+	case c == '0':
+	case isDigitByte(c):
+		s.digits()
+	default:
+		return false
+	}
+
+	if c, ok := s.peek(); ok && c == '.' {
+		s.pos++
+		if !s.requireDigits() {
+			return false
+		}
+	}
+
+	if c, ok := s.peek(); ok && (c == 'e' || c == 'E') {
+		s.pos++
+		if c, ok := s.peek(); ok && (c == '+' || c == '-') {
+			s.pos++
+		}
+		if !s.requireDigits() {
+			return false
+		}
+	}
+	return true
+}
+
+// requireDigits scans at least one digit.
+func (s *scanner) requireDigits() bool {
+	c, ok := s.peek()
+	if !ok {
+		return false
+	}
+	s.pos++
+	if !isDigitByte(c) {
+		return false
+	}
+	s.digits()
+	return true
+}
+
+func (s *scanner) digits() {
+	for {
+		c, ok := s.peek()
+		if !ok || !isDigitByte(c) {
+			return
+		}
+		s.pos++
+	}
+}
+
+func (s *scanner) literal(lit string) bool {
+	for i := 0; i < len(lit); i++ {
+		c, ok := s.peek()
+		if !ok {
+			return false
+		}
+		s.pos++
+		if c != lit[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// expect skips spaces and then expects the given character.
+func (s *scanner) expect(want byte) bool {
+	c, ok := s.skipSpaces()
+	if !ok {
+		return false
+	}
+	s.pos++
+	return c == want
+}
+
+// skipSpaces skips spaces returning the first character that
+// is not a space, without consuming it.
+func (s *scanner) skipSpaces() (byte, bool) {
+	for {
+		c, ok := s.peek()
+		if !ok || !isSpace(c) {
+			return c, ok
+		}
+		s.pos++
+	}
+}
+
+// peek returns the next byte to be scanned, without consuming it.
+// If there is no more data to be read it returns false.
+func (s *scanner) peek() (byte, bool) {
+	for s.pos >= len(s.buf) {
+		if !s.fill() {
+			return 0, false
+		}
+	}
+	return s.buf[s.pos], true
+}
+
+// fill reads more data into the buffer, returning false if the input
+// has no more data. The buffer is only compacted (discarding the
+// already consumed tokens) when full, so only the mark and position
+// of the current token need to be adjusted.
+func (s *scanner) fill() bool {
+	if s.err != nil {
+		return false
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return false
+	}
+
+	if len(s.buf) == cap(s.buf) && s.mark > 0 {
+		n := copy(s.buf, s.buf[s.mark:])
+		s.buf = s.buf[:n]
+		s.pos -= s.mark
+		s.mark = 0
+	}
+	if len(s.buf) == cap(s.buf) {
+		grown := make([]byte, len(s.buf), 2*cap(s.buf))
+		copy(grown, s.buf)
+		s.buf = grown
+	}
+
+	// From the docs:
+	//
+	// https://golang.org/pkg/io/#Reader
+	//
+	// Implementations of Read are discouraged from
+	// returning a zero byte count with a nil error,
+	// except when len(p) == 0. Callers should treat a
+	// return of 0 and nil as indicating that nothing happened;
+	// in particular it does not indicate EOF.
+	//
+	// So we just try again on this case.
+	n, err := s.read(s.buf[len(s.buf):cap(s.buf)])
+	s.buf = s.buf[:len(s.buf)+n]
+	s.err = err
+	return n > 0 || err == nil
+}
+
+// readResult is the result of a read.
+type readResult struct {
+	n   int
+	err error
+}
+
+// read reads data from the input. When there is a stalled callback
+// the read is done on another goroutine, so the callback can be called
+// while the read waits. If the callback fails its error is returned,
+// once the read is done, and the data read is discarded.
+func (s *scanner) read(p []byte) (int, error) {
+	if s.stalled == nil {
+		return s.r.Read(p)
+	}
+
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := s.r.Read(p)
+		done <- readResult{n: n, err: err}
+	}()
+
+	timer := time.NewTimer(stallTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.n, res.err
+	case <-timer.C:
+	}
+
+	err := s.stalled()
+	res := <-done
+	if err != nil {
+		return 0, err
+	}
+	return res.n, res.err
+}
+
+// readErr returns the error that stopped the reading.
+// When all the input was read it returns io.EOF.
+func (s *scanner) readErr() error {
+	if s.err == nil {
+		return io.EOF
+	}
+	return s.err
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// isPlainByte returns true if c can't start a JSON value
+// and is not a space or list delimiter.
+func isPlainByte(c byte) bool {
+	switch c {
+	case '{', '[', ']', '"', '-', 't', 'f', 'n':
+		return false
+	}
+	return !isSpace(c) && !isDigitByte(c)
+}
+
+func isDigitByte(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexByte(c byte) bool {
+	return isDigitByte(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,731 @@
+package jtoh
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// stepKind identifies how a single step of a field selector
+// navigates a JSON value.
+type stepKind int
+
+const (
+	keyStep stepKind = iota
+	wildcardStep
+	descentStep
+	indexStep
+	sliceStep
+	jsonStep
+)
+
+// jsonOperator decodes a string with an embedded
+// JSON document, like "textPayload->msg".
+const jsonOperator = "->"
+
+// step is one navigation step of a field selector.
+// The selector "spans[1:3].name" for example is composed by the
+// steps: key "spans", slice [1:3] and key "name".
+type step struct {
+	kind     stepKind
+	key      string
+	wildcard bool
+	index    int
+	start    int
+	end      int
+	hasStart bool
+	hasEnd   bool
+}
+
+// path is a sequence of steps that navigates a JSON object.
+// Paths that may match multiple values (like slices) are multi
+// valued and always evaluate to a list.
+type path struct {
+	steps []step
+	multi bool
+}
+
+func newPath(steps []step) path {
+	multi := false
+	for _, s := range steps {
+		if s.kind == sliceStep || s.kind == wildcardStep || s.wildcard {
+			multi = true
+		}
+	}
+	return path{steps: steps, multi: multi}
+}
+
+// Selector is a parsed field selector that can be evaluated against
+// decoded JSON objects without being parsed again.
+// A selector has one or more alternative paths, the first
+// one that matches is selected, and may also have a default value
+// used when none matches. Selected numbers can also be formatted.
+type Selector struct {
+	raw string
+	// rawPaths is the part of raw with the paths, without
+	// the number format and default value.
+	rawPaths     string
+	paths        []path
+	format       string
+	defaultValue string
+	hasDefault   bool
+}
+
+// SelectorErr is the error returned when parsing an invalid selector,
+// it indicates the column (starting at 1) of the offending character.
+// It wraps InvalidSelectorErr, so errors.Is can be used to check for it.
+type SelectorErr struct {
+	Selector string
+	Column   int
+	Reason   string
+}
+
+// Parse parses a single field selector, like:
+//
+// resource.labels."app.kubernetes.io/name"
+//
+// Check New for details on the selector syntax.
+// If the selector is invalid it returns a *SelectorErr.
+func Parse(selector string) (Selector, error) {
+	p := selectorParser{src: []rune(selector), full: selector}
+	return p.selector()
+}
+
+// parseSelectors parses all field selectors, which are separated
+// by the first character of the selector. Errors report columns
+// relative to the whole selector.
+func parseSelectors(selector []rune) ([]Selector, error) {
+	fields := splitSelectors(selector[1:], selector[0])
+	selectors := make([]Selector, len(fields))
+	offset := 1
+
+	for i, field := range fields {
+		leadingSpaces := len([]rune(field)) - len([]rune(strings.TrimLeftFunc(field, unicode.IsSpace)))
+		p := selectorParser{
+			src:    []rune(strings.TrimSpace(field)),
+			full:   string(selector),
+			offset: offset + leadingSpaces,
+		}
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		selectors[i] = sel
+		offset += len([]rune(field)) + 1
+	}
+	return selectors, nil
+}
+
+// String returns the selector as it was parsed.
+func (s Selector) String() string {
+	return s.raw
+}
+
+// keys returns the keys of the selector when it is just a path
+// of keys, like "resource.labels.pod", with no fallbacks.
+func (s Selector) keys() ([]string, bool) {
+	if len(s.paths) != 1 {
+		return nil, false
+	}
+	keys := make([]string, len(s.paths[0].steps))
+	for i, st := range s.paths[0].steps {
+		if st.kind != keyStep {
+			return nil, false
+		}
+		keys[i] = st.key
+	}
+	return keys, true
+}
+
+// Select evaluates the selector against the given object.
+// If nothing matches it returns the selector default value, or false
+// if the selector has no default.
+//
+// Selectors that may match multiple values (like slices or wildcards)
+// return a list with all matched values.
+func (s Selector) Select(obj map[string]interface{}) (interface{}, bool) {
+	for _, p := range s.paths {
+		if v, ok := p.selectValue(obj); ok {
+			return v, true
+		}
+	}
+	if s.hasDefault {
+		return s.defaultValue, true
+	}
+	return nil, false
+}
+
+// selectValue evaluates the path against the given object.
+// Multi valued paths return a list with all the matched values.
+// A recursive descent that is not combined with a wildcard
+// returns the shallowest match.
+// If nothing matches it returns false.
+func (p path) selectValue(obj map[string]interface{}) (interface{}, bool) {
+	values := []interface{}{obj}
+	for _, st := range p.steps {
+		var next []interface{}
+		for _, v := range values {
+			next = st.apply(v, next)
+		}
+		values = next
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	if p.multi {
+		return values, true
+	}
+	return values[0], true
+}
+
+// apply applies the step on the given value, appending
+// all values it matches to the matched list.
+func (s step) apply(v interface{}, matched []interface{}) []interface{} {
+	switch s.kind {
+	case keyStep:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return matched
+		}
+		val, ok := obj[s.key]
+		if !ok {
+			return matched
+		}
+		return append(matched, val)
+	case wildcardStep:
+		return append(matched, children(v)...)
+	case descentStep:
+		return s.descend(v, matched)
+	case jsonStep:
+		return decodeEmbedded(v, matched)
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return matched
+	}
+
+	if s.kind == indexStep {
+		i := s.index
+		if i < 0 {
+			i += len(list)
+		}
+		if i < 0 || i >= len(list) {
+			return matched
+		}
+		return append(matched, list[i])
+	}
+
+	start, end := 0, len(list)
+	if s.hasStart {
+		start = sliceBound(s.start, len(list))
+	}
+	if s.hasEnd {
+		end = sliceBound(s.end, len(list))
+	}
+	if start >= end {
+		return matched
+	}
+	return append(matched, list[start:end]...)
+}
+
+// descend matches the step key on the given value and all its
+// descendants, shallowest matches first.
+func (s step) descend(v interface{}, matched []interface{}) []interface{} {
+	queue := []interface{}{v}
+	for len(queue) > 0 {
+		v, queue = queue[0], queue[1:]
+		if s.wildcard {
+			if v, ok := v.(map[string]interface{}); ok {
+				matched = append(matched, children(v)...)
+			}
+			if v, ok := v.([]interface{}); ok {
+				matched = append(matched, v...)
+			}
+		} else if obj, ok := v.(map[string]interface{}); ok {
+			if val, ok := obj[s.key]; ok {
+				matched = append(matched, val)
+			}
+		}
+		queue = append(queue, children(v)...)
+	}
+	return matched
+}
+
+// decodeEmbedded decodes a string with a JSON document, appending the
+// decoded value to the matched list. Objects and lists are matched as
+// they are, since they are usually the same document already decoded.
+func decodeEmbedded(v interface{}, matched []interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}, []interface{}:
+		return append(matched, v)
+	case string:
+		if !json.Valid([]byte(v)) {
+			return matched
+		}
+		var decoded interface{}
+		dec := json.NewDecoder(strings.NewReader(v))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return matched
+		}
+		return append(matched, decoded)
+	}
+	return matched
+}
+
+// children returns all the values of an object, ordered by key,
+// or all the elements of a list. Other values have no children.
+func children(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = v[key]
+		}
+		return values
+	case []interface{}:
+		return v
+	}
+	return nil
+}
+
+// sliceBound normalizes a slice bound that may be negative (relative
+// to the end of the list) or out of the list bounds.
+func sliceBound(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
+
+// splitSelectors splits the field selectors by the given separator
+// ignoring separators that are escaped, quoted or inside brackets,
+// so slices like "[1:3]" can be used even when ":" is the separator.
+func splitSelectors(selectors []rune, separator rune) []string {
+	var (
+		fields  []string
+		field   []rune
+		depth   int
+		quoted  bool
+		escaped bool
+	)
+	syntaxAware := !strings.ContainsRune(`[]"\`, separator)
+
+	for _, c := range selectors {
+		if c == separator && depth == 0 && !quoted && !escaped {
+			fields = append(fields, string(field))
+			field = nil
+			continue
+		}
+		field = append(field, c)
+		if !syntaxAware {
+			continue
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		}
+	}
+	return append(fields, string(field))
+}
+
+type selectorParser struct {
+	src    []rune
+	pos    int
+	full   string
+	offset int
+}
+
+// selector parses alternative paths separated by "|", optionally
+// followed by a default value introduced by "?=", like:
+//
+// message|msg|textPayload?=no message
+func (p *selectorParser) selector() (Selector, error) {
+	sel := Selector{raw: string(p.src)}
+
+	for {
+		column := p.pos + 1
+		steps, err := p.path()
+		if err != nil {
+			return Selector{}, err
+		}
+		if len(sel.paths) > 0 && p.pos+1 == column {
+			return Selector{}, p.errorf(column, "missing path after '|'")
+		}
+
+		sel.paths = append(sel.paths, newPath(steps))
+
+		if p.peek() != '|' {
+			break
+		}
+		p.next()
+	}
+	sel.rawPaths = string(p.src[:p.pos])
+
+	if n := p.format(); n > 0 {
+		column := p.pos + 1
+		if p.pos == 0 {
+			return Selector{}, p.errorf(column, "missing path before number format")
+		}
+		format := string(p.src[p.pos : p.pos+n])
+		if !strings.ContainsRune(formatVerbs, rune(format[len(format)-1])) {
+			return Selector{}, p.errorf(column, "invalid number format %q", format)
+		}
+		sel.format = format
+		p.pos += n
+	}
+
+	if p.defaultValue() {
+		p.pos += len("?=")
+		def, _, err := p.literal(func(rune) bool { return false })
+		if err != nil {
+			return Selector{}, err
+		}
+		sel.defaultValue = def
+		sel.hasDefault = true
+	}
+
+	return sel, nil
+}
+
+// path parses a sequence of dot separated keys where each key may
+// be followed by any number of index/slice accesses, like:
+//
+// spans[0].tags[-1]
+//
+// A key may also be "*", matching any key (or element of a list),
+// and a key preceded by ".." is matched at any depth.
+//
+// Keys may be separated by "->" instead of ".", decoding the JSON
+// document embedded on a string before navigating it, like:
+//
+// textPayload->user.name
+//
+// Keys with special characters can be quoted, or have the special
+// characters escaped with a backslash, like:
+//
+// labels."app.kubernetes.io/name".value
+// labels.app\.kubernetes\.io/name.value
+func (p *selectorParser) path() ([]step, error) {
+	var path []step
+
+	descent := p.descent()
+	for {
+		column := p.pos + 1
+		key, literal, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		wildcard := key == "*" && !literal
+		segment := []step{}
+
+		switch {
+		case descent:
+			if key == "" && !literal {
+				return nil, p.errorf(column, "missing key after '..'")
+			}
+			segment = append(segment, step{
+				kind:     descentStep,
+				key:      key,
+				wildcard: wildcard,
+			})
+		case wildcard:
+			segment = append(segment, step{kind: wildcardStep})
+		case key != "" || literal:
+			segment = append(segment, step{kind: keyStep, key: key})
+		}
+
+		for p.peek() == '[' {
+			s, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			segment = append(segment, s)
+		}
+
+		if len(segment) == 0 {
+			// An empty key is a valid JSON key
+			segment = append(segment, step{kind: keyStep})
+		}
+		path = append(path, segment...)
+
+		if p.lookahead(jsonOperator) {
+			p.pos += len(jsonOperator)
+			path = append(path, step{kind: jsonStep})
+			if p.pathEnd() {
+				return path, nil
+			}
+			descent = p.descent()
+			continue
+		}
+
+		if p.pathEnd() {
+			return path, nil
+		}
+		if c := p.next(); c != '.' {
+			return nil, p.errorf(p.pos, "unexpected %q", c)
+		}
+		if p.peek() == '.' {
+			p.next()
+			descent = true
+		} else {
+			descent = false
+		}
+	}
+}
+
+// pathEnd returns true if the path ends at the current position.
+func (p *selectorParser) pathEnd() bool {
+	return p.eof() || p.peek() == '|' || p.defaultValue() || p.format() > 0
+}
+
+// descent consumes a leading ".." returning true if it was found.
+func (p *selectorParser) descent() bool {
+	if p.lookahead("..") {
+		p.pos += 2
+		return true
+	}
+	return false
+}
+
+// formatVerbs are the fmt verbs supported on number formats.
+const formatVerbs = "dxXobeEfFgG"
+
+// format returns the length of the number format, like "%.2f",
+// that starts at the current position, or 0 if there is none.
+// A "%" only starts a format when it is followed by flags, width,
+// precision and a verb (any letter, so invalid verbs can be reported)
+// and then the end of the selector or a default value, so keys with
+// a "%" don't need to be escaped most of the time.
+func (p *selectorParser) format() int {
+	src := p.src[p.pos:]
+	if len(src) == 0 || src[0] != '%' {
+		return 0
+	}
+	i := 1
+	for i < len(src) && strings.ContainsRune("-+# 0", src[i]) {
+		i++
+	}
+	for i < len(src) && unicode.IsDigit(src[i]) {
+		i++
+	}
+	if i < len(src) && src[i] == '.' {
+		i++
+		for i < len(src) && unicode.IsDigit(src[i]) {
+			i++
+		}
+	}
+	if i >= len(src) || src[i] > unicode.MaxASCII || !unicode.IsLetter(src[i]) {
+		return 0
+	}
+	i++
+	if i < len(src) && !hasPrefix(src[i:], "?=") {
+		return 0
+	}
+	return i
+}
+
+// defaultValue returns true if a default value starts at
+// the current position.
+func (p *selectorParser) defaultValue() bool {
+	return p.lookahead("?=")
+}
+
+func (p *selectorParser) lookahead(s string) bool {
+	return hasPrefix(p.src[p.pos:], s)
+}
+
+func hasPrefix(src []rune, prefix string) bool {
+	i := 0
+	for _, r := range prefix {
+		if i >= len(src) || src[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// key parses a key, handling quotes and escapes. It returns true
+// if any part of the key was quoted or escaped, since a literal key
+// is never a wildcard.
+func (p *selectorParser) key() (string, bool, error) {
+	return p.literal(func(c rune) bool {
+		return c == '.' || c == '[' || c == '|' ||
+			(c == '?' && p.defaultValue()) || (c == '%' && p.format() > 0) ||
+			(c == '-' && p.lookahead(jsonOperator))
+	})
+}
+
+// literal parses text until the end of the selector or until stop
+// returns true for an unquoted/unescaped character.
+// It returns true if any part of the text was quoted or escaped.
+func (p *selectorParser) literal(stop func(rune) bool) (string, bool, error) {
+	var (
+		text    []rune
+		literal bool
+	)
+	for !p.eof() {
+		if stop(p.peek()) {
+			return string(text), literal, nil
+		}
+		switch p.peek() {
+		case '\\':
+			c, err := p.escaped()
+			if err != nil {
+				return "", false, err
+			}
+			text = append(text, c)
+			literal = true
+		case '"':
+			quoted, err := p.quoted()
+			if err != nil {
+				return "", false, err
+			}
+			text = append(text, quoted...)
+			literal = true
+		default:
+			text = append(text, p.next())
+		}
+	}
+	return string(text), literal, nil
+}
+
+func (p *selectorParser) quoted() ([]rune, error) {
+	open := p.pos
+	p.next()
+
+	var quoted []rune
+	for {
+		switch p.peek() {
+		case '"':
+			p.next()
+			return quoted, nil
+		case '\\':
+			c, err := p.escaped()
+			if err != nil {
+				return nil, err
+			}
+			quoted = append(quoted, c)
+		default:
+			if p.eof() {
+				return nil, p.errorf(open+1, "unclosed quote")
+			}
+			quoted = append(quoted, p.next())
+		}
+	}
+}
+
+func (p *selectorParser) escaped() (rune, error) {
+	p.next()
+	if p.eof() {
+		return 0, p.errorf(p.pos, "nothing to escape")
+	}
+	return p.next(), nil
+}
+
+func (p *selectorParser) bracket() (step, error) {
+	open := p.pos
+	p.next()
+
+	start := p.pos
+	for !p.eof() && p.peek() != ']' {
+		p.pos++
+	}
+	if p.eof() {
+		return step{}, p.errorf(open+1, "unclosed '['")
+	}
+	contents := string(p.src[start:p.pos])
+	p.next()
+
+	bounds := strings.Split(contents, ":")
+	switch len(bounds) {
+	case 1:
+		index, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return step{}, p.errorf(start+1, "invalid index %q", contents)
+		}
+		return step{kind: indexStep, index: index}, nil
+	case 2:
+		s := step{kind: sliceStep}
+		var err error
+		if s.start, s.hasStart, err = sliceBoundParse(bounds[0]); err != nil {
+			return step{}, p.errorf(start+1, "invalid slice %q", contents)
+		}
+		if s.end, s.hasEnd, err = sliceBoundParse(bounds[1]); err != nil {
+			return step{}, p.errorf(start+1, "invalid slice %q", contents)
+		}
+		return s, nil
+	}
+	return step{}, p.errorf(start+1, "invalid slice %q", contents)
+}
+
+func (e *SelectorErr) Error() string {
+	return fmt.Sprintf("%v:%s:column %d:%s", InvalidSelectorErr, e.Selector, e.Column, e.Reason)
+}
+
+// Unwrap returns InvalidSelectorErr.
+func (e *SelectorErr) Unwrap() error {
+	return InvalidSelectorErr
+}
+
+func sliceBoundParse(bound string) (int, bool, error) {
+	bound = strings.TrimSpace(bound)
+	if bound == "" {
+		return 0, false, nil
+	}
+	v, err := strconv.Atoi(bound)
+	return v, true, err
+}
+
+// errorf creates an error for the given column of the
+// selector being parsed.
+func (p *selectorParser) errorf(column int, format string, args ...interface{}) error {
+	return &SelectorErr{
+		Selector: p.full,
+		Column:   p.offset + column,
+		Reason:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *selectorParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *selectorParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *selectorParser) next() rune {
+	c := p.peek()
+	p.pos++
+	return c
+}
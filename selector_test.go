@@ -0,0 +1,170 @@
+package jtoh_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestSelectorErrors(t *testing.T) {
+	type Test struct {
+		name       string
+		selector   string
+		parse      bool
+		wantColumn int
+	}
+
+	tests := []Test{
+		{
+			name:       "UnclosedIndex",
+			selector:   ":list[0",
+			wantColumn: 6,
+		},
+		{
+			name:       "InvalidIndexOnSecondField",
+			selector:   ":field:list[first]",
+			wantColumn: 13,
+		},
+		{
+			name:       "LeadingSpacesAreAccountedFor",
+			selector:   ":field:   list[first]",
+			wantColumn: 16,
+		},
+		{
+			name:       "NonASCIICharsCountAsSingleColumn",
+			selector:   "λcampoλlista[x]",
+			wantColumn: 14,
+		},
+		{
+			name:       "UnexpectedCharAfterIndex",
+			selector:   ":list[0]field",
+			wantColumn: 9,
+		},
+		{
+			name:       "UnclosedQuote",
+			selector:   `:a:b."field`,
+			wantColumn: 6,
+		},
+		{
+			name:       "MissingKeyAfterRecursiveDescent",
+			selector:   ":nested..",
+			wantColumn: 10,
+		},
+		{
+			name:       "EmptyFallback",
+			selector:   ":message|",
+			wantColumn: 10,
+		},
+		{
+			name:       "InvalidNumberFormatVerb",
+			selector:   ":a:latency%.2z",
+			wantColumn: 11,
+		},
+		{
+			name:       "MissingPathBeforeNumberFormat",
+			selector:   ":a:%d",
+			wantColumn: 4,
+		},
+		{
+			name:       "ParseUnclosedIndex",
+			selector:   "list[0",
+			parse:      true,
+			wantColumn: 5,
+		},
+		{
+			name:       "ParseInvalidSlice",
+			selector:   "nested.list[a:b]",
+			parse:      true,
+			wantColumn: 13,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		t.Run(test.name, func(t *testing.T) {
+			var err error
+			if test.parse {
+				_, err = jtoh.Parse(test.selector)
+			} else {
+				_, err = jtoh.New(test.selector)
+			}
+
+			if !errors.Is(err, jtoh.InvalidSelectorErr) {
+				t.Fatalf("got err[%v] want[%v]", err, jtoh.InvalidSelectorErr)
+			}
+
+			var selErr *jtoh.SelectorErr
+			if !errors.As(err, &selErr) {
+				t.Fatalf("got err[%v] want a *jtoh.SelectorErr", err)
+			}
+			if selErr.Selector != test.selector {
+				t.Errorf("got selector %q want %q", selErr.Selector, test.selector)
+			}
+			if selErr.Column != test.wantColumn {
+				t.Errorf("got column %d want %d", selErr.Column, test.wantColumn)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	obj := map[string]interface{}{
+		"msg": "hi",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"a", "b", "c"},
+		},
+	}
+
+	type Test struct {
+		selector string
+		want     interface{}
+		wantOK   bool
+	}
+
+	tests := []Test{
+		{selector: "msg", want: "hi", wantOK: true},
+		{selector: "nested.list[-1]", want: "c", wantOK: true},
+		{selector: "missing|msg", want: "hi", wantOK: true},
+		{selector: "missing?=default", want: "default", wantOK: true},
+		{selector: "missing", wantOK: false},
+	}
+
+	for _, test := range tests {
+		sel, err := jtoh.Parse(test.selector)
+		if err != nil {
+			t.Fatalf("Parse(%q): unexpected error [%v]", test.selector, err)
+		}
+		if got := sel.String(); got != test.selector {
+			t.Errorf("String(): got %q want %q", got, test.selector)
+		}
+
+		got, ok := sel.Select(obj)
+		if ok != test.wantOK {
+			t.Errorf("Select(%q): got ok %t want %t", test.selector, ok, test.wantOK)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Select(%q): got %v want %v", test.selector, got, test.want)
+		}
+	}
+
+	got, ok := mustParse(t, "nested.list[1:]").Select(obj)
+	if !ok {
+		t.Fatal("unexpected missing slice")
+	}
+	list, ok := got.([]interface{})
+	if !ok || len(list) != 2 || list[0] != "b" || list[1] != "c" {
+		t.Errorf("got %v want [b c]", got)
+	}
+}
+
+func mustParse(t *testing.T, selector string) jtoh.Selector {
+	t.Helper()
+
+	sel, err := jtoh.Parse(selector)
+	if err != nil {
+		t.Fatalf("Parse(%q): unexpected error [%v]", selector, err)
+	}
+	return sel
+}
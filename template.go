@@ -0,0 +1,209 @@
+package jtoh
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// NewTemplate creates a new jtoh transformer that renders each JSON
+// object using the given Go text/template, for example:
+//
+// {{.timestamp}} [{{.severity}}] {{.textPayload}}
+//
+// The template is executed with the decoded JSON object, so fields
+// can be accessed directly, and besides the text/template builtins
+// these functions are also available:
+//
+//	sel "<selector>" .      select a field using the jtoh selector syntax
+//	pad <width> <value>     left align the value, padding it with spaces
+//	padLeft <width> <value> right align the value, padding it with spaces
+//	trunc <length> <value>  truncate the value to the given length
+//	upper <value>           upper case the value
+//	lower <value>           lower case the value
+//	default <def> <value>   use def if the value is missing or empty
+//	join <sep> <list>       join the list elements with sep
+//	json <value>            render the value as compact JSON
+//	time <layout> <value>   reformat an RFC 3339 timestamp using layout
+//
+// Numbers are float64, so they can be compared with float constants
+// (like {{if ge .status 500.0}}) and are rendered like JSON numbers
+// (1.50 is rendered as 1.5), except for numbers that float64 can't hold
+// exactly (like big IDs), which are json.Number and rendered as they are.
+//
+// Just like with selected fields, newlines on the rendered
+// template are escaped so each JSON object is rendered in a single line.
+//
+// If the template is invalid it returns an error.
+func NewTemplate(text string, opts ...Option) (J, error) {
+	j := J{}.with(opts)
+	if j.format == JSONFormat || j.format == LogfmtFormat {
+		return J{}, fmt.Errorf("%w:can't be used with the %v output format", InvalidTemplateErr, j.format)
+	}
+	tmpl, err := template.New("jtoh").Funcs(templateFuncs(j.flatten)).Parse(text)
+	if err != nil {
+		return J{}, fmt.Errorf("%w:%v", InvalidTemplateErr, err)
+	}
+	j.tmpl = tmpl
+	return j, nil
+}
+
+func (j J) execTemplate(obj map[string]interface{}) string {
+	var rendered strings.Builder
+	if err := j.tmpl.Execute(&rendered, templateValue(obj)); err != nil {
+		return escapeNewlines(rendered.String()) + templateErrMsg(err)
+	}
+	return escapeNewlines(rendered.String())
+}
+
+// templateNumber is a number given to templates. It is a float64, so
+// it can be compared with float constants, but it is rendered like a JSON
+// number instead of using exponents for large numbers (like 1.234567e+06).
+type templateNumber float64
+
+// String implements fmt.Stringer.
+func (n templateNumber) String() string {
+	encoded, _ := json.Marshal(float64(n))
+	return string(encoded)
+}
+
+// templateValue returns a copy of v with its numbers as templateNumber,
+// so they can be compared on templates. Numbers that float64 can't hold
+// exactly (like big IDs) are kept as json.Number.
+func templateValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(val))
+		for name, elem := range val {
+			obj[name] = templateValue(elem)
+		}
+		return obj
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, elem := range val {
+			list[i] = templateValue(elem)
+		}
+		return list
+	case json.Number:
+		if f, ok := exactFloat(val); ok {
+			return templateNumber(f)
+		}
+	}
+	return v
+}
+
+// exactFloat returns the number as a float64 if no precision is lost,
+// which is when the shortest decimal that reads back as the float64
+// has the same value as the number (so 0.1 and 1.50 are converted,
+// but not 1594600000000000123).
+func exactFloat(n json.Number) (float64, bool) {
+	f, err := n.Float64()
+	if err != nil {
+		return 0, false
+	}
+	want, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return 0, false
+	}
+	got, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return f, ok && got.Cmp(want) == 0
+}
+
+func templateErrMsg(err error) string {
+	return fmt.Sprintf("<jtoh:template error %q>", err.Error())
+}
+
+func templateFuncs(flatten bool) template.FuncMap {
+	// Selectors are parsed once and reused for all objects.
+	var selectors sync.Map
+
+	return template.FuncMap{
+		"sel": func(selector string, obj map[string]interface{}) (string, error) {
+			if sel, ok := selectors.Load(selector); ok {
+				v, _ := selectField(sel.(Selector), obj, flatten)
+				return v, nil
+			}
+			sel, err := Parse(selector)
+			if err != nil {
+				return "", err
+			}
+			selectors.Store(selector, sel)
+			v, _ := selectField(sel, obj, flatten)
+			return v, nil
+		},
+		"pad": func(width int, v interface{}) string {
+			s := toString(v)
+			return s + padding(width, s)
+		},
+		"padLeft": func(width int, v interface{}) string {
+			s := toString(v)
+			return padding(width, s) + s
+		},
+		"trunc": func(length int, v interface{}) string {
+			s := []rune(toString(v))
+			if length < 0 || len(s) <= length {
+				return string(s)
+			}
+			return string(s[:length])
+		},
+		"upper": func(v interface{}) string {
+			return strings.ToUpper(toString(v))
+		},
+		"lower": func(v interface{}) string {
+			return strings.ToLower(toString(v))
+		},
+		"default": func(def, v interface{}) interface{} {
+			if v == nil || v == "" {
+				return def
+			}
+			return v
+		},
+		"join": func(sep string, v interface{}) string {
+			list, ok := v.([]interface{})
+			if !ok {
+				return toString(v)
+			}
+			elems := make([]string, len(list))
+			for i, elem := range list {
+				elems[i] = toString(elem)
+			}
+			return strings.Join(elems, sep)
+		},
+		"json": func(v interface{}) (string, error) {
+			encoded, err := json.Marshal(v)
+			return string(encoded), err
+		},
+		"time": func(layout string, v interface{}) string {
+			s := toString(v)
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return s
+			}
+			return t.Format(layout)
+		},
+	}
+}
+
+func padding(width int, s string) string {
+	n := width - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat(" ", n)
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,175 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestTemplate(t *testing.T) {
+	type Test struct {
+		name   string
+		tmpl   string
+		input  []string
+		output []string
+		// some outputs, like errors, are only checked by prefix
+		prefixOnly bool
+		wantErr    error
+	}
+
+	tests := []Test{
+		{
+			name:    "ErrOnInvalidTemplate",
+			tmpl:    "{{.field",
+			wantErr: jtoh.InvalidTemplateErr,
+		},
+		{
+			name:    "ErrOnUnknownFunction",
+			tmpl:    "{{nope .field}}",
+			wantErr: jtoh.InvalidTemplateErr,
+		},
+		{
+			name:   "Fields",
+			tmpl:   "{{.timestamp}} [{{.severity}}] {{.textPayload}}",
+			input:  []string{`{"timestamp":"2020-07-14T13:18:38Z","severity":"ERROR","textPayload":"msg"}`},
+			output: []string{"2020-07-14T13:18:38Z [ERROR] msg"},
+		},
+		{
+			name:   "NestedFields",
+			tmpl:   "{{.resource.labels.pod}}: {{.msg}}",
+			input:  []string{`{"resource":{"labels":{"pod":"app-1"}},"msg":"hi"}`},
+			output: []string{"app-1: hi"},
+		},
+		{
+			name: "MultipleObjs",
+			tmpl: "<{{.n}}>",
+			input: []string{
+				`{"n":1}`,
+				`{"n":2}`,
+			},
+			output: []string{"<1>", "<2>"},
+		},
+		{
+			name:   "NonJSONIsEchoed",
+			tmpl:   "<{{.n}}>",
+			input:  []string{`{"n":1}`, `plain text`},
+			output: []string{"<1>", "", "plain text"},
+		},
+		{
+			name:   "NewlinesAreEscaped",
+			tmpl:   "{{.a}}\n{{.b}}",
+			input:  []string{`{"a":"one\ntwo","b":"three"}`},
+			output: []string{`one\ntwo\nthree`},
+		},
+		{
+			name:   "SelectorFunction",
+			tmpl:   `{{sel "spans[-1].name" .}} {{sel "message|msg?=none" .}} {{sel "missing" .}}`,
+			input:  []string{`{"spans":[{"name":"a"},{"name":"b"}],"msg":"hi"}`},
+			output: []string{`b hi ` + missingFieldErrMsg("missing")},
+		},
+		{
+			name:   "PaddingFunctions",
+			tmpl:   `[{{.severity | pad 7}}][{{.code | padLeft 5}}][{{pad 2 .severity}}]`,
+			input:  []string{`{"severity":"INFO","code":42}`},
+			output: []string{"[INFO   ][   42][INFO]"},
+		},
+		{
+			name:   "StringFunctions",
+			tmpl:   `{{upper .a}} {{lower .b}} {{trunc 3 .c}} {{trunc 10 .c}}`,
+			input:  []string{`{"a":"up","b":"DOWN","c":"truncated"}`},
+			output: []string{"UP down tru truncated"},
+		},
+		{
+			name:   "DefaultFunction",
+			tmpl:   `{{default "anonymous" .user}} {{.msg | default "none"}}`,
+			input:  []string{`{"msg":"hi"}`},
+			output: []string{"anonymous hi"},
+		},
+		{
+			name:   "JoinFunction",
+			tmpl:   `{{join "," .tags}} {{join "," .tag}}`,
+			input:  []string{`{"tags":["a","b",3],"tag":"single"}`},
+			output: []string{"a,b,3 single"},
+		},
+		{
+			name:   "JSONFunction",
+			tmpl:   `{{json .obj}} {{json .list}}`,
+			input:  []string{`{"obj":{"b":2,"a":"1"},"list":[1,"x",null]}`},
+			output: []string{`{"a":"1","b":2} [1,"x",null]`},
+		},
+		{
+			name:   "TimeFunction",
+			tmpl:   `{{time "15:04:05" .timestamp}} {{time "15:04" .invalid}}`,
+			input:  []string{`{"timestamp":"2020-07-14T13:18:38.741851348Z","invalid":"yesterday"}`},
+			output: []string{"13:18:38 yesterday"},
+		},
+		{
+			name:   "CompareNumbers",
+			tmpl:   `{{if ge .status 500.0}}server error{{else}}ok{{end}} {{if lt .took 0.5}}fast{{end}}`,
+			input:  []string{`{"status":503,"took":0.25}`, `{"status":200,"took":1}`},
+			output: []string{"server error fast", "ok "},
+		},
+		{
+			name: "CompareNumbersHowEverTheyAreWritten",
+			tmpl: `{{.a}}:{{if ge .a 100.0}}big{{else}}small{{end}}`,
+			input: []string{
+				`{"a":1234567}`,
+				`{"a":1.50}`,
+				`{"a":1e3}`,
+				`{"a":0.1}`,
+				`{"a":-2E-1}`,
+			},
+			output: []string{"1234567:big", "1.5:small", "1000:big", "0.1:small", "-0.2:small"},
+		},
+		{
+			name:   "NumbersAreRenderedWithoutLosingPrecision",
+			tmpl:   `{{.id}} {{.n}} {{.price}} {{json .}} {{sel "n%05d" .}}`,
+			input:  []string{`{"id":1594600000000000123,"n":42,"price":1.50}`},
+			output: []string{`1594600000000000123 42 1.5 {"id":1594600000000000123,"n":42,"price":1.5} 00042`},
+		},
+		{
+			name:       "ExecErrorIsRendered",
+			tmpl:       `{{.msg}} {{sel "a[" .}}`,
+			input:      []string{`{"msg":"hi"}`},
+			output:     []string{"hi <jtoh:template error"},
+			prefixOnly: true,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+
+		t.Run(test.name, func(t *testing.T) {
+			j, err := jtoh.NewTemplate(test.tmpl)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("got err[%v] want[%v]", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error [%v]", err)
+			}
+
+			output := bytes.Buffer{}
+			j.Do(strings.NewReader(strings.Join(test.input, "\n")), &output)
+
+			gotLines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+			if len(gotLines) != len(test.output) {
+				t.Fatalf("got %d lines %q, want %d %q", len(gotLines), gotLines, len(test.output), test.output)
+			}
+			for i, want := range test.output {
+				got := gotLines[i]
+				if test.prefixOnly && strings.HasPrefix(got, want) {
+					continue
+				}
+				if got != want {
+					t.Errorf("line[%d]: got %q want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
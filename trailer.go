@@ -0,0 +1,199 @@
+package jtoh
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// trailerField is the name of the pseudo-field with the
+// lines that follow a record, like a stack trace.
+const trailerField = "_trailer"
+
+// trailerIndent is written before each line of
+// the trailers rendered under their records.
+const trailerIndent = "    "
+
+const (
+	// defaultMaxTrailerSize is the default maximum
+	// size of the lines grouped with a record.
+	defaultMaxTrailerSize = 64 * 1024
+	// maxTrailerLines is the maximum number
+	// of lines grouped with a record.
+	maxTrailerLines = 1000
+)
+
+// WithTrailers configures the transformer to group the lines that
+// continue a record, like stack traces logged after a JSON object,
+// with the record instead of echoing them. Continuation lines are
+// indented lines and the lines that start Java, Go and Python stack
+// traces (like "at ...", "Caused by:", "goroutine 1 [running]:" or
+// "Traceback (most recent call last):").
+//
+// The lines are available as the "_trailer" field, joined by newlines,
+// and with TextFormat they are also written indented under the record.
+// At most 1000 lines are grouped with a record (see WithMaxTrailerSize),
+// the continuation lines after that are echoed.
+//
+// Since a record is only written once a line that doesn't continue it is
+// read (or the input ends), when the input is a stream that stops for a
+// while the last record is only written when more data arrives.
+func WithTrailers() Option {
+	return func(j *J) {
+		j.trailers = true
+	}
+}
+
+// WithMaxTrailerSize configures the maximum size of the lines grouped
+// with a record (see WithTrailers). Once the size is reached the record
+// is written and the continuation lines after that are echoed.
+// The default is 64KiB.
+func WithMaxTrailerSize(size int) Option {
+	return func(j *J) {
+		j.maxTrailerSize = size
+	}
+}
+
+// traceKind is the kind of stack trace being grouped,
+// some lines are only continuations inside a trace.
+type traceKind int
+
+const (
+	noTrace traceKind = iota
+	goTrace
+	pythonTrace
+)
+
+var (
+	goroutineLine = regexp.MustCompile(`^goroutine \d+ \[`)
+	javaException = regexp.MustCompile(`^([\w$]+\.)+[\w$]*(Exception|Error)\b`)
+	javaMoreLines = regexp.MustCompile(`^\.\.\. \d+ (more|common frames omitted)`)
+)
+
+// recordGroup is a record waiting for its continuation lines.
+type recordGroup struct {
+	obj     map[string]interface{}
+	pending bool
+	lines   []string
+	// size is the size of the lines, with their newlines.
+	size    int
+	maxSize int
+	trace   traceKind
+	// blanks is how many blank lines were found after the
+	// last line, they are only part of the trailer if more
+	// continuation lines follow them.
+	blanks int
+	// restOfLine is true when the next line is the rest of
+	// the line of the record, which is only a continuation
+	// if it is blank (like the newline after a JSON object).
+	restOfLine bool
+}
+
+func newRecordGroup(maxSize int) recordGroup {
+	if maxSize <= 0 {
+		maxSize = defaultMaxTrailerSize
+	}
+	return recordGroup{maxSize: maxSize}
+}
+
+// start starts a new group with the given record.
+func (g *recordGroup) start(obj map[string]interface{}, restOfLine bool) {
+	*g = recordGroup{
+		obj:        obj,
+		pending:    true,
+		maxSize:    g.maxSize,
+		restOfLine: restOfLine,
+	}
+}
+
+// add adds the line to the group, returning false if the line
+// doesn't continue the record or if the group is full.
+func (g *recordGroup) add(line []byte) bool {
+	blank := len(bytes.TrimSpace(line)) == 0
+	if g.restOfLine {
+		g.restOfLine = false
+		return blank
+	}
+	if blank {
+		g.blanks++
+		return true
+	}
+
+	text := strings.TrimRight(string(line), "\r")
+	size := g.size + g.blanks + len(text) + 1
+	if len(g.lines)+g.blanks >= maxTrailerLines || size > g.maxSize {
+		return false
+	}
+	if !g.continues(text) {
+		return false
+	}
+	for ; g.blanks > 0; g.blanks-- {
+		g.lines = append(g.lines, "")
+	}
+	g.lines = append(g.lines, text)
+	g.size = size
+	return true
+}
+
+// continues returns true if the line continues the record,
+// updating the kind of trace being grouped.
+func (g *recordGroup) continues(line string) bool {
+	indented := line[0] == ' ' || line[0] == '\t'
+
+	switch g.trace {
+	case goTrace:
+		// Goroutines are separated by blank lines
+		if g.blanks == 0 || goroutineLine.MatchString(line) {
+			return true
+		}
+	case pythonTrace:
+		if !indented {
+			// The exception ends the trace
+			g.trace = noTrace
+		}
+		return true
+	}
+
+	switch {
+	case goroutineLine.MatchString(line), strings.HasPrefix(line, "panic: "):
+		g.trace = goTrace
+		return true
+	case strings.HasPrefix(line, "Traceback (most recent call last):"):
+		g.trace = pythonTrace
+		return true
+	}
+
+	return indented ||
+		strings.HasPrefix(line, "at ") ||
+		strings.HasPrefix(line, "Caused by: ") ||
+		strings.HasPrefix(line, "Exception in thread ") ||
+		javaException.MatchString(line) ||
+		javaMoreLines.MatchString(line)
+}
+
+// end ends the group, returning the record with its trailer.
+func (g *recordGroup) end() (map[string]interface{}, bool) {
+	if !g.pending {
+		return nil, false
+	}
+	obj := g.obj
+	if len(g.lines) > 0 {
+		obj[trailerField] = strings.Join(g.lines, "\n")
+	}
+	*g = recordGroup{maxSize: g.maxSize}
+	return obj, true
+}
+
+// writeTrailer writes the trailer of the record indented.
+func writeTrailer(w io.Writer, trailer string, color string) error {
+	var buf strings.Builder
+	for _, line := range strings.Split(trailer, "\n") {
+		if line != "" {
+			buf.WriteString(colorize(color, trailerIndent+line))
+		}
+		buf.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
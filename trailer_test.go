@@ -0,0 +1,276 @@
+package jtoh_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/jtoh"
+)
+
+func TestTrailers(t *testing.T) {
+	type Test struct {
+		name     string
+		selector string
+		opts     []jtoh.Option
+		input    []string
+		want     []string
+	}
+
+	tests := []Test{
+		{
+			name:     "JavaStackTrace",
+			selector: ":msg",
+			input: []string{
+				`{"msg":"failed"}`,
+				`java.lang.IllegalStateException: boom`,
+				`	at com.example.App.run(App.java:10)`,
+				`Caused by: java.io.IOException: disk`,
+				`	... 2 more`,
+				`not a continuation`,
+			},
+			want: []string{
+				"failed",
+				"    java.lang.IllegalStateException: boom",
+				"    	at com.example.App.run(App.java:10)",
+				"    Caused by: java.io.IOException: disk",
+				"    	... 2 more",
+				"not a continuation",
+			},
+		},
+		{
+			name:     "GoStackTrace",
+			selector: ":msg",
+			input: []string{
+				`{"msg":"failed"}`,
+				`panic: boom`,
+				``,
+				`goroutine 1 [running]:`,
+				`main.main()`,
+				`	/app/main.go:12 +0x1d`,
+				``,
+				`goroutine 2 [sleep]:`,
+				`time.Sleep()`,
+				``,
+				`exit status 2`,
+			},
+			want: []string{
+				"failed",
+				"    panic: boom",
+				"",
+				"    goroutine 1 [running]:",
+				"    main.main()",
+				"    	/app/main.go:12 +0x1d",
+				"",
+				"    goroutine 2 [sleep]:",
+				"    time.Sleep()",
+				"exit status 2",
+			},
+		},
+		{
+			name:     "PythonStackTrace",
+			selector: ":msg",
+			input: []string{
+				`{"msg":"failed"}`,
+				`Traceback (most recent call last):`,
+				`  File "app.py", line 3, in <module>`,
+				`ValueError: bad`,
+				`not a continuation`,
+			},
+			want: []string{
+				"failed",
+				"    Traceback (most recent call last):",
+				`      File "app.py", line 3, in <module>`,
+				"    ValueError: bad",
+				"not a continuation",
+			},
+		},
+		{
+			name:     "Selected",
+			selector: ":msg:_trailer",
+			input: []string{
+				`{"msg":"failed"}`,
+				`  at first`,
+				`  at second`,
+				`{"msg":"ok"}`,
+			},
+			want: []string{
+				`failed:  at first\n  at second`,
+				"      at first",
+				"      at second",
+				`ok:<jtoh:missing field "_trailer">`,
+			},
+		},
+		{
+			name:     "LogfmtRecord",
+			selector: ":msg",
+			input: []string{
+				`level=error msg=failed`,
+				`  at first`,
+			},
+			want: []string{
+				"failed",
+				"      at first",
+			},
+		},
+		{
+			name:     "TextAfterObjectOnSameLine",
+			selector: ":msg",
+			input: []string{
+				`{"msg":"first"}  at same line`,
+				`  at next line`,
+			},
+			want: []string{
+				"first",
+				"  at same line",
+				"  at next line",
+			},
+		},
+		{
+			name:     "TextBeforeAnyRecord",
+			selector: ":msg",
+			input: []string{
+				`text`,
+				`  at first()`,
+				`{"msg":"first"}`,
+			},
+			want: []string{
+				"text",
+				"  at first()",
+				"first",
+			},
+		},
+		{
+			name:     "FilteredWithTheRecord",
+			selector: ":msg",
+			opts: []jtoh.Option{
+				jtoh.WithFilter(mustParseFilter(t, `_trailer =~ "NullPointer"`)),
+			},
+			input: []string{
+				`{"msg":"first"}`,
+				`  at first`,
+				`{"msg":"second"}`,
+				`java.lang.NullPointerException`,
+				`  at second`,
+			},
+			want: []string{
+				"second",
+				"    java.lang.NullPointerException",
+				"      at second",
+			},
+		},
+		{
+			name:     "DockerLogs",
+			selector: ":msg",
+			opts:     []jtoh.Option{jtoh.WithContainerLogs()},
+			input: []string{
+				`{"log":"{\"msg\":\"failed\"}\n","stream":"stderr","time":"2024-01-01T00:00:00Z"}`,
+				`{"log":"\tat first\n","stream":"stderr","time":"2024-01-01T00:00:00Z"}`,
+				`{"log":"plain\n","stream":"stderr","time":"2024-01-01T00:00:00Z"}`,
+			},
+			want: []string{
+				"failed",
+				"    	at first",
+				"2024-01-01T00:00:00Z stderr plain",
+			},
+		},
+		{
+			name:     "SizeIsLimited",
+			selector: ":msg",
+			opts:     []jtoh.Option{jtoh.WithMaxTrailerSize(24)},
+			input: []string{
+				`{"msg":"failed"}`,
+				`  at first`,
+				`  at second`,
+				`  at third`,
+				`{"msg":"ok"}`,
+				`  at fourth`,
+			},
+			want: []string{
+				"failed",
+				"      at first",
+				"      at second",
+				"  at third",
+				"ok",
+				"      at fourth",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := strings.Join(test.input, "\n")
+			opts := append([]jtoh.Option{jtoh.WithTrailers()}, test.opts...)
+			testTransform(t, input, test.selector, test.want, nil, opts...)
+		})
+	}
+}
+
+func TestTrailersAreBounded(t *testing.T) {
+	const (
+		maxTrailerSize = 1024
+		inputSize      = 1024 * 1024
+	)
+
+	j, err := jtoh.New(":a", jtoh.WithTrailers(), jtoh.WithMaxTrailerSize(maxTrailerSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := io.MultiReader(
+		strings.NewReader(`{"a":"failed"}`+"\n"),
+		&repeatReader{data: []byte("\tat com.example.App.run(App.java:10)\n"), size: inputSize},
+	)
+	output := &writesRecorder{}
+	if err := j.DoContext(context.Background(), input, output); err != nil {
+		t.Fatal(err)
+	}
+
+	// The trailer is written on a single write, with each line indented,
+	// and the lines after it are echoed as they are read.
+	const maxWrite = 64 * 1024
+	if output.maxWrite > maxWrite {
+		t.Errorf("got a write of %d bytes; want at most %d", output.maxWrite, maxWrite)
+	}
+	if output.total < inputSize {
+		t.Errorf("got %d bytes written; want at least %d", output.total, inputSize)
+	}
+}
+
+func TestTrailersAreOnlyWrittenWithTextFormat(t *testing.T) {
+	j, err := jtoh.New(":msg:_trailer", jtoh.WithTrailers(), jtoh.WithOutput(jtoh.CSVFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`{"msg":"failed"}`,
+		`  at first`,
+		`  at second`,
+	}, "\n")
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader(input), output)
+
+	want := `failed,"  at first\n  at second"` + "\n"
+	if output.String() != want {
+		t.Errorf("got %q want %q", output.String(), want)
+	}
+}
+
+func TestTrailersAreNotGroupedByDefault(t *testing.T) {
+	j, err := jtoh.New(":msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := &bytes.Buffer{}
+	j.Do(strings.NewReader("{\"msg\":\"failed\"}\n  at first"), output)
+
+	want := "failed\n\n  at first\n"
+	if output.String() != want {
+		t.Errorf("got %q want %q", output.String(), want)
+	}
+}